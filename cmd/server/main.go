@@ -1,27 +1,22 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// time zones used in publish dates must be available in minimal images
+	_ "time/tzdata"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/pkg/errors"
 
 	"github.com/wamphlett/blog-server/config"
-	"github.com/wamphlett/blog-server/pkg/indexing"
-	database "github.com/wamphlett/blog-server/pkg/memoryDatabase"
-	memorydatabase "github.com/wamphlett/blog-server/pkg/memoryDatabase"
 	"github.com/wamphlett/blog-server/pkg/metrics"
-	"github.com/wamphlett/blog-server/pkg/model"
-	"github.com/wamphlett/blog-server/pkg/reading"
-	"github.com/wamphlett/blog-server/pkg/scheduler"
 	"github.com/wamphlett/blog-server/pkg/serving"
-	"github.com/wamphlett/blog-server/pkg/updating"
+	"github.com/wamphlett/blog-server/pkg/tracing"
 )
 
 func main() {
@@ -41,98 +36,105 @@ func main() {
 	}
 
 	// create a new metrics client
-	metricsClient := metrics.New(cfg.Influx, metrics.WithDefaultTags(map[string]string{
+	backend, err := newMetricsBackend(cfg)
+	if err != nil {
+		sentry.CaptureException(err)
+		slog.Error("failed to create metrics backend", "error", err)
+		os.Exit(1)
+	}
+	metricsClient := metrics.New(backend, metrics.WithDefaultTags(map[string]string{
 		"environment": cfg.Environment,
 	}))
 
-	// create a new in memory database
-	database := memorydatabase.New()
-
-	// create a new indexer
-	indexer := indexing.NewIndex(database, metricsClient)
-
-	// create a new reader
-	reader := reading.New(indexer, cfg.StaticAssetsURL, cfg.ContentAssetDir, metricsClient)
-
-	// create a new updater
-	_, err = updating.New(
-		cfg.ContentPath,
-		cfg.TopicFile,
-		reader,
-		metricsClient,
-		updating.WithRemoteRepository(cfg.ContentRepo),
-		updating.WithRefreshInterval(time.Duration(cfg.ContentUpdateIntervalSeconds)*time.Second),
-		// the indexer directly receives the topics and articles every time the content is updated
-		updating.WithReceiver(updateReceiver(cfg.BlogSiteHost, cfg.BlogSiteSecret, database, indexer)),
+	// trace requests, renders, updates and reindexes
+	tracingProvider, err := tracing.New(cfg.TracingExporter,
+		tracing.WithServiceName(cfg.TracingServiceName),
+		tracing.WithEnvironment(cfg.Environment),
+		tracing.WithSampleRatio(cfg.TracingSampleRatio),
+		tracing.WithOTLPEndpoint(cfg.TracingOTLPEndpoint),
 	)
 	if err != nil {
-		err = errors.Wrap(err, "failed to create updater")
 		sentry.CaptureException(err)
-		slog.Error("failed to create updater", "error", err)
+		slog.Error("failed to set up tracing", "error", err)
 		os.Exit(1)
 	}
 
-	// schedule a reindex every 24 hours
-	scheduler := scheduler.New(time.Date(0, 0, 0, 0, 1, 0, 0, time.Local), func() {
-		indexer.Reindex()
-		invalidateSiteCaches(cfg.BlogSiteHost, "/", cfg.BlogSiteSecret)
-	})
+	// create a site for every tenant
+	sites := []*site{}
+	for _, tenantCfg := range cfg.Tenants {
+		site, err := newSite(cfg, tenantCfg, metricsClient)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to create site for tenant %s", tenantCfg.Name)
+			sentry.CaptureException(err)
+			slog.Error("failed to create site", "tenant", tenantCfg.Name, "error", err)
+			os.Exit(1)
+		}
+		sites = append(sites, site)
+	}
 
-	// create and run a new server
-	server := serving.New(reader, indexer, cfg.ContentPath, cfg.ContentAssetDir, cfg.TopicFile, metricsClient,
-		serving.WithPort(cfg.ServerPort), serving.WithAllowedOrigins(cfg.ServerAllowedOrigins))
+	// create and run a new server, hosting every tenant if there are several
+	var server interface {
+		ListenAndServe()
+		Shutdown()
+	}
+	if cfg.TenantsFile == "" {
+		server = sites[0].server
+	} else {
+		tenants := make([]*serving.Tenant, len(sites))
+		for i, site := range sites {
+			tenants[i] = site.tenant
+		}
+		server = serving.NewTenantServer(cfg.ServerPort, tenants)
+	}
 	go server.ListenAndServe()
 
 	// wait for shutdown signals
 	sig := <-signals
 	slog.Info("shutdown signal received", "signal", sig)
 	server.Shutdown()
-	scheduler.Shutdown()
-}
-
-func updateReceiver(blogSitehost, secret string, db *database.Database, index *indexing.Index) func([]*model.Topic, []*model.Article) {
-	firstReceive := true
-	return func(updatedTopics []*model.Topic, updatedArticles []*model.Article) {
-		for _, topic := range updatedTopics {
-			db.StoreTopic(topic)
-		}
-
-		for _, article := range updatedArticles {
-			db.StoreArticle(article)
-		}
-
-		if len(updatedTopics) > 0 || len(updatedArticles) > 0 {
-			slog.Info("reindexing after storing topics and articles", "topics", len(updatedTopics), "articles", len(updatedArticles))
-			index.Reindex()
+	for _, site := range sites {
+		site.scheduler.Shutdown()
+		site.index.Shutdown()
+		site.invalidations.Shutdown()
+		if site.notifier != nil {
+			site.notifier.Shutdown()
 		}
-
-		if firstReceive {
-			slog.Info("first receive, not clearing site cache")
-			firstReceive = false
-			return
+		if site.views != nil {
+			site.views.Shutdown()
 		}
-
-		if len(updatedTopics) == 0 && len(updatedArticles) == 0 {
-			return
-		}
-
-		if blogSitehost == "" || secret == "" {
-			slog.Warn("not clearing site cache as blog site host or secret is not set")
-			return
+		if err := site.db.Close(); err != nil {
+			slog.Error("failed to close database", "tenant", site.tenant.Name, "error", err)
 		}
+	}
+	metricsClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracingProvider.Shutdown(ctx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+}
 
-		for _, topic := range updatedTopics {
-			if err := invalidateSiteCaches(blogSitehost, topic.URI, secret); err != nil {
-				slog.Error("failed to invalidate site cache for topic", "uri", topic.URI, "error", err)
-			}
-		}
+// newMetricsBackend creates the backend which metrics are recorded with
+func newMetricsBackend(cfg *config.Config) (metrics.Backend, error) {
+	backend := cfg.MetricsBackend
+	if backend == "" && cfg.Influx.Host != "" {
+		backend = "influx"
+	}
 
-		for _, article := range updatedArticles {
-			if err := invalidateSiteCaches(blogSitehost, article.URI, secret); err != nil {
-				slog.Error("failed to invalidate site cache for article", "uri", article.URI, "error", err)
-			}
-		}
+	switch backend {
+	case "influx":
+		return metrics.NewInfluxBackend(cfg.Influx,
+			metrics.WithQueueSize(cfg.Influx.QueueSize),
+			metrics.WithBatching(cfg.Influx.BatchSize, time.Duration(cfg.Influx.FlushIntervalSeconds)*time.Second),
+		), nil
+	case "prometheus":
+		return metrics.NewPrometheusBackend(cfg.MetricsNamespace), nil
+	case "", "none":
+		slog.Info("metrics are disabled")
+		return metrics.NewNoopBackend(), nil
 	}
+
+	return nil, errors.Errorf("unknown metrics backend: %s", backend)
 }
 
 func setupLogger(level, format string) {
@@ -149,16 +151,3 @@ func setupLogger(level, format string) {
 	}
 	slog.SetDefault(slog.New(handler))
 }
-
-func invalidateSiteCaches(host, path, secret string) error {
-	slog.Info("invalidating site cache", "path", path)
-	url := fmt.Sprintf("%s/api/revalidate?path=%s&secret=%s", host, path, secret)
-
-	resp, err := http.Post(url, "application/json", nil)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	return nil
-}
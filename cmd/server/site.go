@@ -0,0 +1,447 @@
+package main
+
+import (
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/config"
+	boltdatabase "github.com/wamphlett/blog-server/pkg/boltDatabase"
+	"github.com/wamphlett/blog-server/pkg/counting"
+	"github.com/wamphlett/blog-server/pkg/indexing"
+	"github.com/wamphlett/blog-server/pkg/invalidating"
+	database "github.com/wamphlett/blog-server/pkg/memoryDatabase"
+	"github.com/wamphlett/blog-server/pkg/metrics"
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/notifying"
+	"github.com/wamphlett/blog-server/pkg/reading"
+	"github.com/wamphlett/blog-server/pkg/scheduler"
+	"github.com/wamphlett/blog-server/pkg/serving"
+	"github.com/wamphlett/blog-server/pkg/updating"
+	"github.com/wamphlett/blog-server/pkg/validating"
+)
+
+// site holds everything required to serve a single blog
+type site struct {
+	server        *serving.Server
+	tenant        *serving.Tenant
+	scheduler     *scheduler.Scheduler
+	index         *indexing.Index
+	invalidations invalidating.Group
+	// notifier is nil when there are no webhooks
+	notifier *notifying.Notifier
+	// views is nil when views are not counted
+	views *counting.Counter
+	db    contentDatabase
+}
+
+// contentDatabase stores the topics and articles of a site along with the state of its updaters
+type contentDatabase interface {
+	indexing.Database
+	updating.Store
+	ApplyChanges(changes *model.ContentChanges) (*model.ContentChanges, []error)
+	Close() error
+}
+
+// newSite creates the database, index, updaters and server for the given tenant
+func newSite(cfg *config.Config, tenantCfg *config.TenantConfig, metricsClient *metrics.Client) (*site, error) {
+	if tenantCfg.Name != "" {
+		metricsClient = metricsClient.WithTags(map[string]string{
+			"tenant": tenantCfg.Name,
+		})
+	}
+
+	// create the database, which is kept on disk if a database path is given
+	db, err := newDatabase(cfg, tenantCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// invalidate every target in the background
+	var invalidations invalidating.Group
+	for _, targetCfg := range tenantCfg.InvalidationTargets {
+		invalidator, err := newInvalidator(targetCfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create invalidation target %s", targetCfg.Name)
+		}
+		invalidations = append(invalidations, invalidating.New(invalidator, metricsClient, invalidating.WithName(targetCfg.Name)))
+	}
+	if len(invalidations) == 0 {
+		slog.Warn("caches will not be invalidated as no invalidation targets are configured", "tenant", tenantCfg.Name)
+	}
+
+	indexOptions := []indexing.Option{indexing.WithRelatedCount(cfg.RelatedArticlesCount)}
+
+	// send events to the webhooks as content is published
+	var notifier *notifying.Notifier
+	if len(tenantCfg.Webhooks) > 0 {
+		notifier = newNotifier(tenantCfg, metricsClient)
+		indexOptions = append(indexOptions, indexing.WithReindexedCallback(reindexNotifier(notifier)))
+	}
+
+	// invalidate scheduled articles once they are published, along with anything which has
+	// expired. The dependencies are resolved using the index, so are only created once the
+	// index exists
+	var dependencies *invalidating.Dependencies
+	indexOptions = append(indexOptions, indexing.WithReindexedCallback(func(results indexing.ReindexResults) {
+		changedArticles := append([]*model.Article{}, results.NewArticles...)
+		changedArticles = append(changedArticles, results.UnpublishedArticles...)
+		invalidations.Enqueue(dependencies.AffectedPaths(results.ExpiredTopics, changedArticles)...)
+	}))
+
+	// create a new indexer
+	indexer := indexing.NewIndex(db, metricsClient, indexOptions...)
+	dependencies = invalidating.NewDependencies(indexer,
+		invalidating.WithListingPaths(tenantCfg.InvalidationListingPaths...),
+		invalidating.WithTagPathPrefix(*tenantCfg.InvalidationTagPathPrefix),
+	)
+
+	// create a new reader
+	reader := reading.New(indexer, tenantCfg.StaticAssetsURL, tenantCfg.ContentAssetDir, metricsClient)
+
+	// jobs run on their own schedules and can be inspected and run from the admin endpoints
+	location, err := time.LoadLocation(cfg.SchedulerTimezone)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load scheduler time zone")
+	}
+	reindexSchedule, err := scheduler.ParseCron(cfg.ReindexSchedule)
+	if err != nil {
+		return nil, err
+	}
+	jobs := scheduler.New(scheduler.WithLocation(location))
+
+	// create an updater for every content source, all of which are merged into the same database,
+	// and poll each source for changes on its own interval. A little jitter stops every source
+	// from being fetched at once
+	validator := validating.New(reader, validating.WithMaxBrokenLinks(cfg.ContentMaxBrokenLinks))
+	updaters := updating.Group{}
+	for _, sourceCfg := range tenantCfg.Sources {
+		updater, err := newUpdater(cfg, sourceCfg, reader, validator, metricsClient, db, indexer, invalidations, dependencies)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create updater for source %s", sourceCfg.Name)
+		}
+		updaters = append(updaters, updater)
+
+		interval := time.Duration(sourceCfg.UpdateIntervalSeconds) * time.Second
+		if err := jobs.Register("update-"+sourceCfg.Name, scheduler.Every(interval, interval/10), updater.Poll); err != nil {
+			return nil, err
+		}
+	}
+
+	// reindex on a schedule to pick up anything which changes with time
+	if err := jobs.Register("reindex", reindexSchedule, func() error {
+		indexer.Reindex()
+		invalidations.Enqueue(dependencies.ListingPaths()...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// create a new server
+	if cfg.AccessLogFormat != serving.AccessLogStructured && cfg.AccessLogFormat != serving.AccessLogCombined {
+		return nil, errors.Errorf("unknown access log format %q", cfg.AccessLogFormat)
+	}
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	serverOptions := []serving.Option{
+		serving.WithAccessLog(cfg.AccessLogFormat, os.Stdout),
+		serving.WithTrustedProxies(trustedProxies),
+		serving.WithPathPrefix(tenantCfg.PathPrefix),
+		serving.WithPort(cfg.ServerPort),
+		serving.WithAllowedOrigins(tenantCfg.AllowedOrigins),
+		serving.WithAdminToken(cfg.AdminToken),
+		serving.WithJobs(jobs),
+	}
+	if handler := metricsClient.Handler(); handler != nil {
+		serverOptions = append(serverOptions, serving.WithMetricsHandler(handler))
+	}
+	if updaters.HasHistory() {
+		// revision history is only available when the content is sourced from git
+		serverOptions = append(serverOptions, serving.WithHistory(updaters))
+	}
+	if updaters.IsStaged() {
+		serverOptions = append(serverOptions, serving.WithContentManager(updaters))
+	}
+	if len(invalidations) > 0 {
+		serverOptions = append(serverOptions, serving.WithInvalidations(invalidations))
+	}
+	if notifier != nil {
+		serverOptions = append(serverOptions, serving.WithDeliveries(notifier))
+	}
+	if cfg.ContentExpiredGone {
+		serverOptions = append(serverOptions, serving.WithGoneForExpired())
+	}
+	if cfg.MetricsContentViews {
+		serverOptions = append(serverOptions, serving.WithContentViewMetrics())
+	}
+	var views *counting.Counter
+	if cfg.ViewsEnabled {
+		name := tenantCfg.Name
+		if name == "" {
+			name = "views"
+		}
+		views, err = counting.New(filepath.Join(cfg.ViewsPath, name+".json"), counting.WithRetention(cfg.ViewsRetentionDays))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create view counter")
+		}
+		serverOptions = append(serverOptions, serving.WithViews(views))
+	}
+	// the first source provides the overview, static files can be served from any source
+	primarySource := tenantCfg.Sources[0]
+	for _, sourceCfg := range tenantCfg.Sources[1:] {
+		serverOptions = append(serverOptions, serving.WithAdditionalContentDirs(sourceCfg.Path))
+	}
+	server := serving.New(reader, indexer, primarySource.Path, tenantCfg.ContentAssetDir, primarySource.TopicFile, metricsClient, serverOptions...)
+
+	return &site{
+		server: server,
+		tenant: &serving.Tenant{
+			Name:       tenantCfg.Name,
+			Hosts:      tenantCfg.Hosts,
+			PathPrefix: tenantCfg.PathPrefix,
+			Server:     server,
+		},
+		scheduler:     jobs,
+		index:         indexer,
+		invalidations: invalidations,
+		notifier:      notifier,
+		views:         views,
+		db:            db,
+	}, nil
+}
+
+// newDatabase creates the database for the given tenant, which is kept in memory unless a
+// database path is given
+func newDatabase(cfg *config.Config, tenantCfg *config.TenantConfig) (contentDatabase, error) {
+	if cfg.DatabasePath == "" {
+		return database.New(), nil
+	}
+
+	name := tenantCfg.Name
+	if name == "" {
+		name = "content"
+	}
+	if err := os.MkdirAll(cfg.DatabasePath, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create database directory")
+	}
+	return boltdatabase.Open(filepath.Join(cfg.DatabasePath, name+".db"))
+}
+
+// hasContentFrom reports whether the database already holds content from the given source
+func hasContentFrom(db contentDatabase, source string) bool {
+	for _, topic := range db.GetAllTopics() {
+		if topic.Source == source {
+			return true
+		}
+	}
+	return false
+}
+
+// newUpdater creates an updater for the given content source
+func newUpdater(cfg *config.Config, sourceCfg *config.SourceConfig, reader *reading.Reader, validator *validating.Validator,
+	metricsClient *metrics.Client, db contentDatabase, index *indexing.Index,
+	invalidations invalidating.Group, dependencies *invalidating.Dependencies) (*updating.Updater, error) {
+	source, err := newContentSource(sourceCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return updating.New(
+		sourceCfg.Path,
+		sourceCfg.TopicFile,
+		reader,
+		metricsClient,
+		updating.WithName(sourceCfg.Name),
+		updating.WithSource(source),
+		// content fetched from a remote source must pass validation before it goes live
+		updating.WithValidator(validator),
+		updating.WithRevisionsToKeep(cfg.ContentRevisionsToKeep),
+		updating.WithStore(db),
+		// the indexer directly receives the topics and articles every time the content is updated
+		updating.WithReceiver(updateReceiver(db, index, invalidations, dependencies, !hasContentFrom(db, sourceCfg.Name))),
+	)
+}
+
+func updateReceiver(db contentDatabase, index *indexing.Index, invalidations invalidating.Group,
+	dependencies *invalidating.Dependencies, coldStart bool) updating.Receiver {
+	firstReceive := true
+	return func(changes *model.ContentChanges) {
+		// index the stored content first after a warm start, so the previous versions of any
+		// changed articles can be found
+		if !coldStart && index.GetLastIndexedTime().IsZero() {
+			index.Reindex()
+		}
+
+		// every change is applied at once, anything which conflicts with another source is ignored
+		applied, problems := db.ApplyChanges(changes)
+		for _, err := range problems {
+			slog.Error("failed to apply content change", "error", err)
+			sentry.CaptureException(err)
+		}
+
+		// the previous versions of the content are still affected, for example by removed tags
+		changedTopics := append([]*model.Topic{}, applied.Topics...)
+		for _, topic := range applied.DeletedTopics {
+			if previous := index.GetTopicByIdentifier(topic.Slug); previous != nil {
+				changedTopics = append(changedTopics, previous)
+			}
+		}
+		changedArticles := append([]*model.Article{}, applied.Articles...)
+		for _, article := range append(append([]*model.Article{}, applied.Articles...), applied.DeletedArticles...) {
+			if previous := index.GetArticleByIdentifier(article.TopicSlug, article.Slug); previous != nil {
+				changedArticles = append(changedArticles, previous)
+			}
+		}
+
+		// after a warm start nothing may have changed, but the stored content still needs indexing
+		if !applied.IsEmpty() || index.GetLastIndexedTime().IsZero() {
+			slog.Info("reindexing after applying content changes",
+				"topics", len(applied.Topics),
+				"articles", len(applied.Articles),
+				"deleted_topics", len(applied.DeletedTopics),
+				"deleted_articles", len(applied.DeletedArticles),
+			)
+			index.Reindex()
+		}
+
+		// everything is received on a cold start, whereas after a warm start only what changed
+		// while the server was down is received and needs invalidating
+		if firstReceive {
+			firstReceive = false
+			if coldStart {
+				slog.Info("first receive, not clearing site cache")
+				return
+			}
+		}
+
+		if applied.IsEmpty() {
+			return
+		}
+
+		invalidations.Enqueue(dependencies.AffectedPaths(changedTopics, changedArticles)...)
+	}
+}
+
+// newNotifier creates a notifier which sends events to the tenant's webhooks
+func newNotifier(tenantCfg *config.TenantConfig, metricsClient *metrics.Client) *notifying.Notifier {
+	webhooks := make([]*notifying.Webhook, len(tenantCfg.Webhooks))
+	for i, webhookCfg := range tenantCfg.Webhooks {
+		name := webhookCfg.Name
+		if name == "" {
+			name = webhookCfg.URL
+		}
+		webhooks[i] = &notifying.Webhook{
+			Name:   name,
+			URL:    webhookCfg.URL,
+			Secret: webhookCfg.Secret,
+			Events: webhookCfg.Events,
+		}
+	}
+	return notifying.New(webhooks, metricsClient, notifying.WithTenant(tenantCfg.Name))
+}
+
+// reindexNotifier sends an event for every change found by a reindex
+func reindexNotifier(notifier *notifying.Notifier) indexing.ReindexedCallback {
+	return func(results indexing.ReindexResults) {
+		for _, topic := range results.NewTopics {
+			notifier.NotifyTopic(notifying.TopicCreated, topic)
+		}
+		for _, article := range results.NewArticles {
+			notifier.NotifyArticle(notifying.ArticlePublished, article)
+		}
+		for _, article := range results.UpdatedArticles {
+			notifier.NotifyArticle(notifying.ArticleUpdated, article)
+		}
+		for _, article := range results.UnpublishedArticles {
+			notifier.NotifyArticle(notifying.ArticleUnpublished, article)
+		}
+	}
+}
+
+// parseTrustedProxies parses the trusted proxies, which are either single addresses or CIDR ranges
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid trusted proxy %q", proxy)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %q", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// newContentSource creates the source which the content is fetched from
+func newContentSource(cfg *config.SourceConfig) (updating.ContentSource, error) {
+	sourceType := cfg.Source
+	if sourceType == "" && cfg.Repo != "" {
+		sourceType = "git"
+	}
+
+	switch sourceType {
+	case "", "local":
+		if cfg.LocalPath != "" {
+			return updating.NewLocalSource(cfg.LocalPath), nil
+		}
+		return updating.NewLocalSource(cfg.Path), nil
+	case "git":
+		return updating.NewGitSource(cfg.Repo), nil
+	case "archive":
+		return updating.NewArchiveSource(cfg.Archive), nil
+	case "s3":
+		return updating.NewS3Source(updating.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			Region:    cfg.S3.Region,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		}), nil
+	}
+
+	return nil, errors.Errorf("unknown content source: %s", sourceType)
+}
+
+// newInvalidator creates the invalidator for the given target
+func newInvalidator(cfg *config.InvalidationTargetConfig) (invalidating.Invalidator, error) {
+	switch cfg.Type {
+	case "nextjs":
+		authMode, err := invalidating.ParseAuthMode(cfg.AuthMode)
+		if err != nil {
+			return nil, err
+		}
+		return invalidating.NewNextJSInvalidator(cfg.URL, cfg.Secret, invalidating.WithAuthMode(authMode)), nil
+	case "webhook":
+		return invalidating.NewWebhookInvalidator(cfg.URL, cfg.Secret, cfg.Headers), nil
+	case "cloudflare", "fastly":
+		purgeMode, err := invalidating.ParsePurgeMode(cfg.Purge)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Type == "cloudflare" {
+			return invalidating.NewCloudflareInvalidator(cfg.APIURL, cfg.ZoneID, cfg.Token, cfg.SiteURL, purgeMode), nil
+		}
+		return invalidating.NewFastlyInvalidator(cfg.APIURL, cfg.ServiceID, cfg.Token, cfg.SiteURL, purgeMode), nil
+	}
+
+	return nil, errors.Errorf("unknown invalidation target type: %s", cfg.Type)
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 
 	"github.com/pkg/errors"
 	"github.com/sethvargo/go-envconfig"
@@ -11,13 +13,24 @@ import (
 type Config struct {
 	LogLevel  string `env:"LOG_LEVEL,default=INFO"`
 	LogFormat string `env:"LOG_FORMAT,default=json"`
+	// How requests are logged, either structured with the logger or in the Combined Log Format
+	AccessLogFormat string `env:"ACCESS_LOG_FORMAT,default=structured"`
 
 	Environment          string   `env:"ENVIRONMENT,default=development"`
 	ServerPort           int      `env:"PORT,default=3000"`
 	ServerAllowedOrigins []string `env:"ALLOWED_ORIGINS"`
+	// Where the content is fetched from: local, git, archive or s3. If not specified, the content
+	// is fetched from the remote git repository when one is given, otherwise it is read in place
+	ContentSource string `env:"CONTENT_SOURCE"`
 	// If specified, the updater will clone and fetch the content from the given remote git repository
-	ContentRepo                  string `env:"CONTENT_REPO"`
-	ContentUpdateIntervalSeconds int64  `env:"CONTENT_UPDATE_INTERVAL_SECONDS,default=300"`
+	ContentRepo string `env:"CONTENT_REPO"`
+	// The file path or URL of a .tar.gz or .zip archive to fetch the content from
+	ContentArchive string `env:"CONTENT_ARCHIVE"`
+	// A directory on the local filesystem to copy the content from
+	ContentLocalPath string `env:"CONTENT_LOCAL_PATH"`
+	ContentS3        *S3Config
+	// How often the content is fetched from its source
+	ContentUpdateIntervalSeconds int64 `env:"CONTENT_UPDATE_INTERVAL_SECONDS,default=300"`
 	// The directory where the content is stored
 	// This is where any remote repositories will be cloned to
 	ContentPath string `env:"CONTENT_PATH,default=./content"`
@@ -25,14 +38,84 @@ type Config struct {
 	ContentAssetDir string `env:"CONTENT_ASSET_DIR,default=images"`
 	// The URL where static content will be served from
 	StaticAssetsURL string `env:"STATIC_ASSET_URL,default=images"`
+	// Whether expired topics and articles return 410 Gone rather than 404 Not Found
+	ContentExpiredGone bool `env:"CONTENT_EXPIRED_GONE,default=false"`
+	// If specified, topics, articles and the updaters' state are kept in a database in this
+	// directory so restarts do not start from scratch
+	DatabasePath string `env:"DATABASE_PATH"`
+	// How many good content revisions are kept for rolling back to
+	ContentRevisionsToKeep int `env:"CONTENT_REVISIONS_TO_KEEP,default=3"`
+	// How many broken relative links are tolerated before new content is rejected
+	ContentMaxBrokenLinks int `env:"CONTENT_MAX_BROKEN_LINKS,default=0"`
 
 	// The host of the blog site
 	BlogSiteHost   string `env:"BLOG_SITE_HOST"`
 	BlogSiteSecret string `env:"BLOG_SITE_SECRET"`
+	// How the blog site secret is sent, either query, bearer or hmac
+	BlogSiteAuthMode string `env:"BLOG_SITE_AUTH_MODE,default=query"`
+
+	// The blog site paths which list content and are invalidated on every change
+	InvalidationListingPaths []string `env:"INVALIDATION_LISTING_PATHS,default=/,/topics,/recent,/overview"`
+	// The blog site path which tag pages are found under
+	InvalidationTagPathPrefix string `env:"INVALIDATION_TAG_PATH_PREFIX,default=/tags"`
+	// If specified, further cache invalidation targets are read from the given JSON file
+	InvalidationTargetsFile string `env:"INVALIDATION_TARGETS_FILE"`
+
+	// If specified, events are sent to the webhooks defined in the given JSON file
+	WebhooksFile string `env:"WEBHOOKS_FILE"`
+
+	// The time zone which job schedules are evaluated in
+	SchedulerTimezone string `env:"SCHEDULER_TIMEZONE,default=Local"`
+	// The cron expression which the content is reindexed on
+	ReindexSchedule string `env:"REINDEX_SCHEDULE,default=1 0 * * *"`
+
+	// Whether views of articles are counted, which enables the popular endpoint
+	ViewsEnabled bool `env:"VIEWS_ENABLED,default=false"`
+	// The directory where view counts are kept, with a file for each tenant
+	ViewsPath string `env:"VIEWS_PATH,default=./data/views"`
+	// How many days of views are kept for finding popular articles
+	ViewsRetentionDays int `env:"VIEWS_RETENTION_DAYS,default=90"`
+	// The addresses or CIDR ranges of the proxies, such as the blog site, whose X-Forwarded-For
+	// and X-Real-IP headers are trusted to hold the visitor's address
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// How many related articles are found for each article
+	RelatedArticlesCount int `env:"RELATED_ARTICLES_COUNT,default=3"`
+
+	// If specified, enables the admin endpoints which must be called with this bearer token
+	AdminToken string `env:"ADMIN_TOKEN"`
 
 	// The name which topic files use, everything else will be considered an article
 	TopicFile string `env:"TOPIC_FILE,default=README.md"`
 
+	// If specified, the content sources are read from the given JSON file rather than the
+	// CONTENT_ environment variables, allowing several sources to be merged into one site
+	ContentSourcesFile string `env:"CONTENT_SOURCES_FILE"`
+	// Sources holds every configured content source
+	Sources []*SourceConfig
+
+	// If specified, several blogs are hosted from one process using the tenants defined in
+	// the given JSON file
+	TenantsFile string `env:"TENANTS_FILE"`
+	// Tenants holds every configured tenant. Without a tenants file, there is a single tenant
+	// configured from the environment variables
+	Tenants []*TenantConfig
+
+	// Where metrics are recorded: influx, prometheus or none. Defaults to influx if an influx
+	// host is set, otherwise none
+	MetricsBackend string `env:"METRICS_BACKEND"`
+	// The prefix of every prometheus metric
+	MetricsNamespace string `env:"METRICS_NAMESPACE,default=blog"`
+	// Whether views of each topic and article are counted, which creates a series per item
+	MetricsContentViews bool `env:"METRICS_CONTENT_VIEWS,default=false"`
+
+	// Where traces are exported: otlp, stdout or none
+	TracingExporter string `env:"TRACING_EXPORTER,default=none"`
+	// The URL of the OTLP collector, otherwise the standard OTEL_EXPORTER_OTLP_ variables are used
+	TracingOTLPEndpoint string  `env:"TRACING_OTLP_ENDPOINT"`
+	TracingServiceName  string  `env:"TRACING_SERVICE_NAME,default=blog-server"`
+	TracingSampleRatio  float64 `env:"TRACING_SAMPLE_RATIO,default=1"`
+
 	Influx    *InfluxConfig
 	SentryDSN string `env:"SENTRY_DSN"`
 }
@@ -43,17 +126,289 @@ type InfluxConfig struct {
 	Bucket string `env:"INFLUX_BUCKET"`
 	Token  string `env:"INFLUX_TOKEN"`
 	Org    string `env:"INFLUX_ORG"`
+
+	// Points are written in the background in batches, and dropped if the queue is full
+	QueueSize            int `env:"INFLUX_QUEUE_SIZE,default=10000"`
+	BatchSize            int `env:"INFLUX_BATCH_SIZE,default=500"`
+	FlushIntervalSeconds int `env:"INFLUX_FLUSH_INTERVAL_SECONDS,default=10"`
+}
+
+// S3Config defines the config to fetch content from an S3-compatible bucket
+type S3Config struct {
+	Endpoint  string `env:"CONTENT_S3_ENDPOINT" json:"endpoint"`
+	Bucket    string `env:"CONTENT_S3_BUCKET" json:"bucket"`
+	Prefix    string `env:"CONTENT_S3_PREFIX" json:"prefix"`
+	Region    string `env:"CONTENT_S3_REGION,default=us-east-1" json:"region"`
+	AccessKey string `env:"CONTENT_S3_ACCESS_KEY" json:"accessKey"`
+	SecretKey string `env:"CONTENT_S3_SECRET_KEY" json:"secretKey"`
+}
+
+// SourceConfig defines the config for a single content source
+type SourceConfig struct {
+	// The name of the source, which is included with every topic and article it provides
+	Name string `json:"name"`
+	// The directory where the content is stored
+	Path string `json:"path"`
+	// Where the content is fetched from: local, git, archive or s3
+	Source    string    `json:"source"`
+	Repo      string    `json:"repo"`
+	Archive   string    `json:"archive"`
+	LocalPath string    `json:"localPath"`
+	S3        *S3Config `json:"s3"`
+
+	TopicFile             string `json:"topicFile"`
+	UpdateIntervalSeconds int64  `json:"updateIntervalSeconds"`
 }
 
-// NewFromEnv reads the environment variables and creates a new config
+// TenantConfig defines the config for a single blog when hosting several blogs
+type TenantConfig struct {
+	// The name of the tenant, which is attached to every metric as a tag
+	Name string `json:"name"`
+	// Requests for any of the given hosts are routed to the tenant
+	Hosts []string `json:"hosts"`
+	// Requests starting with the given path prefix are routed to the tenant
+	PathPrefix     string   `json:"pathPrefix"`
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	ContentAssetDir string `json:"contentAssetDir"`
+	StaticAssetsURL string `json:"staticAssetUrl"`
+
+	BlogSiteHost     string `json:"blogSiteHost"`
+	BlogSiteSecret   string `json:"blogSiteSecret"`
+	BlogSiteAuthMode string `json:"blogSiteAuthMode"`
+
+	// Every target to invalidate when content changes, including the blog site if configured
+	InvalidationTargets []*InvalidationTargetConfig `json:"invalidationTargets"`
+	// The paths which list content along with where tag pages are found on the blog site
+	InvalidationListingPaths  []string `json:"invalidationListingPaths"`
+	InvalidationTagPathPrefix *string  `json:"invalidationTagPathPrefix"`
+
+	// Every webhook which is sent events when content is published
+	Webhooks []*WebhookConfig `json:"webhooks"`
+
+	Sources []*SourceConfig `json:"sources"`
+}
+
+// WebhookConfig defines the config for somewhere events are sent to
+type WebhookConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// If specified, every request is signed using the secret
+	Secret string `json:"secret"`
+	// The types of event to send, every event is sent if empty
+	Events []string `json:"events"`
+}
+
+// InvalidationTargetConfig defines the config for somewhere to invalidate when content changes
+type InvalidationTargetConfig struct {
+	// The name of the target, which is used in metrics and dead letters
+	Name string `json:"name"`
+	// The type of target: nextjs, webhook, cloudflare or fastly
+	Type string `json:"type"`
+
+	// The URL of the Next.js site or webhook, along with the secret used to authenticate
+	URL      string            `json:"url"`
+	Secret   string            `json:"secret"`
+	AuthMode string            `json:"authMode"`
+	Headers  map[string]string `json:"headers"`
+
+	// The CDN API to purge, defaulting to the public API
+	APIURL    string `json:"apiUrl"`
+	Token     string `json:"token"`
+	ZoneID    string `json:"zoneId"`
+	ServiceID string `json:"serviceId"`
+	// The public URL of the site, which paths are appended to when purging by URL
+	SiteURL string `json:"siteUrl"`
+	// Whether to purge by url or by surrogate key
+	Purge string `json:"purge"`
+}
+
+// NewFromEnv reads the environment variables and creates a new config. The config is returned
+// even when it fails to load, so the logger can be set up to report the error
 func NewFromEnv() (*Config, error) {
 	ctx := context.Background()
 
 	c := &Config{}
 	if err := envconfig.Process(ctx, c); err != nil {
 		err = errors.Wrap(err, "failed to load config from env")
-		return nil, err
+		return c, err
+	}
+
+	if err := c.loadSources(); err != nil {
+		return c, err
+	}
+
+	if err := c.loadTenants(); err != nil {
+		return c, err
 	}
 
 	return c, nil
 }
+
+// loadSources reads the content sources from the sources file, or creates a single source
+// from the environment variables if there is no sources file
+func (c *Config) loadSources() error {
+	if c.ContentSourcesFile == "" {
+		c.Sources = []*SourceConfig{{
+			Name:                  "default",
+			Path:                  c.ContentPath,
+			Source:                c.ContentSource,
+			Repo:                  c.ContentRepo,
+			Archive:               c.ContentArchive,
+			LocalPath:             c.ContentLocalPath,
+			S3:                    c.ContentS3,
+			TopicFile:             c.TopicFile,
+			UpdateIntervalSeconds: c.ContentUpdateIntervalSeconds,
+		}}
+		return nil
+	}
+
+	b, err := os.ReadFile(c.ContentSourcesFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read content sources file")
+	}
+	if err := json.Unmarshal(b, &c.Sources); err != nil {
+		return errors.Wrap(err, "failed to parse content sources file")
+	}
+
+	return c.applySourceDefaults(c.Sources)
+}
+
+// applySourceDefaults validates the given sources and fills in any missing values from the
+// environment variables
+func (c *Config) applySourceDefaults(sources []*SourceConfig) error {
+	if len(sources) == 0 {
+		return errors.New("no content sources are defined")
+	}
+
+	names := map[string]bool{}
+	for _, source := range sources {
+		if source.Name == "" || source.Path == "" {
+			return errors.New("every content source must have a name and a path")
+		}
+		if names[source.Name] {
+			return errors.Errorf("content source name is used more than once: %s", source.Name)
+		}
+		names[source.Name] = true
+
+		if source.TopicFile == "" {
+			source.TopicFile = c.TopicFile
+		}
+		if source.UpdateIntervalSeconds == 0 {
+			source.UpdateIntervalSeconds = c.ContentUpdateIntervalSeconds
+		}
+		if source.S3 == nil {
+			source.S3 = &S3Config{}
+		}
+	}
+
+	return nil
+}
+
+// loadTenants reads the tenants from the tenants file, or creates a single unnamed tenant from
+// the environment variables if there is no tenants file
+func (c *Config) loadTenants() error {
+	if c.TenantsFile == "" {
+		c.Tenants = []*TenantConfig{{
+			AllowedOrigins:   c.ServerAllowedOrigins,
+			ContentAssetDir:  c.ContentAssetDir,
+			StaticAssetsURL:  c.StaticAssetsURL,
+			BlogSiteHost:     c.BlogSiteHost,
+			BlogSiteSecret:   c.BlogSiteSecret,
+			BlogSiteAuthMode: c.BlogSiteAuthMode,
+			Sources:          c.Sources,
+
+			InvalidationListingPaths:  c.InvalidationListingPaths,
+			InvalidationTagPathPrefix: &c.InvalidationTagPathPrefix,
+		}}
+		if c.InvalidationTargetsFile != "" {
+			b, err := os.ReadFile(c.InvalidationTargetsFile)
+			if err != nil {
+				return errors.Wrap(err, "failed to read invalidation targets file")
+			}
+			if err := json.Unmarshal(b, &c.Tenants[0].InvalidationTargets); err != nil {
+				return errors.Wrap(err, "failed to parse invalidation targets file")
+			}
+		}
+		if c.WebhooksFile != "" {
+			b, err := os.ReadFile(c.WebhooksFile)
+			if err != nil {
+				return errors.Wrap(err, "failed to read webhooks file")
+			}
+			if err := json.Unmarshal(b, &c.Tenants[0].Webhooks); err != nil {
+				return errors.Wrap(err, "failed to parse webhooks file")
+			}
+		}
+		return applyInvalidationDefaults(c.Tenants[0])
+	}
+
+	b, err := os.ReadFile(c.TenantsFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read tenants file")
+	}
+	if err := json.Unmarshal(b, &c.Tenants); err != nil {
+		return errors.Wrap(err, "failed to parse tenants file")
+	}
+	if len(c.Tenants) == 0 {
+		return errors.New("tenants file does not define any tenants")
+	}
+
+	names := map[string]bool{}
+	for _, tenant := range c.Tenants {
+		if tenant.Name == "" {
+			return errors.New("every tenant must have a name")
+		}
+		if names[tenant.Name] {
+			return errors.Errorf("tenant name is used more than once: %s", tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		if tenant.ContentAssetDir == "" {
+			tenant.ContentAssetDir = c.ContentAssetDir
+		}
+		if tenant.StaticAssetsURL == "" {
+			tenant.StaticAssetsURL = c.StaticAssetsURL
+		}
+		if tenant.InvalidationListingPaths == nil {
+			tenant.InvalidationListingPaths = c.InvalidationListingPaths
+		}
+		if tenant.InvalidationTagPathPrefix == nil {
+			tenant.InvalidationTagPathPrefix = &c.InvalidationTagPathPrefix
+		}
+		if err := c.applySourceDefaults(tenant.Sources); err != nil {
+			return errors.Wrapf(err, "invalid sources for tenant %s", tenant.Name)
+		}
+		if err := applyInvalidationDefaults(tenant); err != nil {
+			return errors.Wrapf(err, "invalid invalidation targets for tenant %s", tenant.Name)
+		}
+	}
+
+	return nil
+}
+
+// applyInvalidationDefaults adds the blog site as a Next.js target when it is configured and
+// makes sure every target has a unique name
+func applyInvalidationDefaults(tenant *TenantConfig) error {
+	if tenant.BlogSiteHost != "" && tenant.BlogSiteSecret != "" {
+		tenant.InvalidationTargets = append([]*InvalidationTargetConfig{{
+			Name:     "blog-site",
+			Type:     "nextjs",
+			URL:      tenant.BlogSiteHost,
+			Secret:   tenant.BlogSiteSecret,
+			AuthMode: tenant.BlogSiteAuthMode,
+		}}, tenant.InvalidationTargets...)
+	}
+
+	names := map[string]bool{}
+	for _, target := range tenant.InvalidationTargets {
+		if target.Name == "" {
+			target.Name = target.Type
+		}
+		if names[target.Name] {
+			return errors.Errorf("invalidation target name is used more than once: %s", target.Name)
+		}
+		names[target.Name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package boltdatabase
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	memorydatabase "github.com/wamphlett/blog-server/pkg/memoryDatabase"
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+var (
+	topicsBucket        = []byte("topics")
+	articlesBucket      = []byte("articles")
+	updaterStatesBucket = []byte("updater_states")
+)
+
+// Database keeps the topics, articles and updater states in a file on disk so they survive a
+// restart. Everything is also held in memory, so reads never touch the disk
+type Database struct {
+	db     *bolt.DB
+	memory *memorydatabase.Database
+}
+
+// Open opens the database at the given path, creating it if it does not exist, and loads
+// everything stored in it
+func Open(path string) (*Database, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open database %s", path)
+	}
+
+	d := &Database{
+		db:     db,
+		memory: memorydatabase.New(),
+	}
+	if err := d.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// load creates the buckets and reads every topic and article into memory
+func (d *Database) load() error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{topicsBucket, articlesBucket, updaterStatesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrapf(err, "failed to create %s bucket", name)
+			}
+		}
+
+		// topics are loaded first as articles are checked against them
+		topics := 0
+		if err := tx.Bucket(topicsBucket).ForEach(func(k, v []byte) error {
+			topic := &model.Topic{}
+			if err := json.Unmarshal(v, topic); err != nil {
+				return errors.Wrapf(err, "failed to decode topic %s", k)
+			}
+			topics++
+			return d.memory.StoreTopic(topic)
+		}); err != nil {
+			return err
+		}
+
+		articles := 0
+		if err := tx.Bucket(articlesBucket).ForEach(func(k, v []byte) error {
+			article := &model.Article{}
+			if err := json.Unmarshal(v, article); err != nil {
+				return errors.Wrapf(err, "failed to decode article %s", k)
+			}
+			articles++
+			return d.memory.StoreArticle(article)
+		}); err != nil {
+			return err
+		}
+
+		slog.Info("loaded database", "path", d.db.Path(), "topics", topics, "articles", articles)
+		return nil
+	})
+}
+
+// StoreTopic stores the given topic. An error is returned if a different source has already
+// provided a topic with the same slug
+func (d *Database) StoreTopic(topic *model.Topic) error {
+	if err := d.memory.StoreTopic(topic); err != nil {
+		return err
+	}
+	return d.put(topicsBucket, topic.Slug, topic)
+}
+
+// StoreArticle stores the given article. An error is returned if the article's topic has been
+// provided by a different source
+func (d *Database) StoreArticle(article *model.Article) error {
+	if err := d.memory.StoreArticle(article); err != nil {
+		return err
+	}
+	return d.put(articlesBucket, articleKey(article.TopicSlug, article.Slug), article)
+}
+
+// DeleteTopic deletes the topic with the given slug along with all of its articles
+func (d *Database) DeleteTopic(slug string) error {
+	if err := d.memory.DeleteTopic(slug); err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return deleteTopic(tx, slug)
+	})
+}
+
+// DeleteArticle deletes the article with the given slug
+func (d *Database) DeleteArticle(topicSlug, slug string) error {
+	if err := d.memory.DeleteArticle(topicSlug, slug); err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return errors.Wrapf(tx.Bucket(articlesBucket).Delete([]byte(articleKey(topicSlug, slug))), "failed to delete article %s", slug)
+	})
+}
+
+// ApplyChanges applies every change at once, both in memory and in a single transaction on
+// disk. Changes which conflict with another source are skipped and returned as errors, and the
+// changes which were applied are returned
+func (d *Database) ApplyChanges(changes *model.ContentChanges) (*model.ContentChanges, []error) {
+	applied, problems := d.memory.ApplyChanges(changes)
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, topic := range applied.DeletedTopics {
+			if err := deleteTopic(tx, topic.Slug); err != nil {
+				return err
+			}
+		}
+		for _, article := range applied.DeletedArticles {
+			if err := tx.Bucket(articlesBucket).Delete([]byte(articleKey(article.TopicSlug, article.Slug))); err != nil {
+				return errors.Wrapf(err, "failed to delete article %s", article.Slug)
+			}
+		}
+		for _, topic := range applied.Topics {
+			if err := put(tx, topicsBucket, topic.Slug, topic); err != nil {
+				return err
+			}
+		}
+		for _, article := range applied.Articles {
+			if err := put(tx, articlesBucket, articleKey(article.TopicSlug, article.Slug), article); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, errors.Wrap(err, "failed to write changes to disk"))
+	}
+
+	return applied, problems
+}
+
+func (d *Database) GetAllTopics() []*model.Topic {
+	return d.memory.GetAllTopics()
+}
+
+func (d *Database) GetAllArticles() []*model.Article {
+	return d.memory.GetAllArticles()
+}
+
+func (d *Database) GetAllArticlesForTopic(topicSlug string) []*model.Article {
+	return d.memory.GetAllArticlesForTopic(topicSlug)
+}
+
+// GetUpdaterState returns the state stored by the updater of the given source, or nil if there
+// is none
+func (d *Database) GetUpdaterState(source string) (*model.UpdaterState, error) {
+	var state *model.UpdaterState
+	err := d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(updaterStatesBucket).Get([]byte(source))
+		if v == nil {
+			return nil
+		}
+		state = &model.UpdaterState{}
+		return errors.Wrapf(json.Unmarshal(v, state), "failed to decode updater state for %s", source)
+	})
+	return state, err
+}
+
+// StoreUpdaterState stores the state of the updater of the given source
+func (d *Database) StoreUpdaterState(source string, state *model.UpdaterState) error {
+	return d.put(updaterStatesBucket, source, state)
+}
+
+// Close closes the database file
+func (d *Database) Close() error {
+	return errors.Wrap(d.db.Close(), "failed to close database")
+}
+
+func (d *Database) put(bucket []byte, key string, value interface{}) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, bucket, key, value)
+	})
+}
+
+func put(tx *bolt.Tx, bucket []byte, key string, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %s", key)
+	}
+	return errors.Wrapf(tx.Bucket(bucket).Put([]byte(key), encoded), "failed to store %s", key)
+}
+
+// deleteTopic deletes the topic along with every article stored under it
+func deleteTopic(tx *bolt.Tx, slug string) error {
+	if err := tx.Bucket(topicsBucket).Delete([]byte(slug)); err != nil {
+		return errors.Wrapf(err, "failed to delete topic %s", slug)
+	}
+
+	// the articles of subtopics are stored under the same prefix, so are kept
+	prefix := []byte(slug + "/")
+	keys := [][]byte{}
+	cursor := tx.Bucket(articlesBucket).Cursor()
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		if !bytes.Contains(k[len(prefix):], []byte("/")) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+	}
+	for _, k := range keys {
+		if err := tx.Bucket(articlesBucket).Delete(k); err != nil {
+			return errors.Wrapf(err, "failed to delete article %s", k)
+		}
+	}
+	return nil
+}
+
+func articleKey(topicSlug, slug string) string {
+	return topicSlug + "/" + slug
+}
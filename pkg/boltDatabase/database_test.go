@@ -0,0 +1,78 @@
+package boltdatabase_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	boltdatabase "github.com/wamphlett/blog-server/pkg/boltDatabase"
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+func TestKeepsContentAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "content.db")
+	db, err := boltdatabase.Open(path)
+	require.NoError(t, err)
+
+	require.NoError(t, db.StoreTopic(&model.Topic{Slug: "go", Source: "main", Title: "Go"}))
+	require.NoError(t, db.StoreArticle(&model.Article{Slug: "channels", TopicSlug: "go", Source: "main", Tags: []string{"concurrency"}}))
+	require.NoError(t, db.StoreUpdaterState("main", &model.UpdaterState{
+		Checksums:      map[string]string{"go/channels.md": "abc"},
+		Revisions:      []*model.ContentRevision{{ID: "v1", Live: true}},
+		PinnedRevision: "v2",
+	}))
+	require.Error(t, db.StoreTopic(&model.Topic{Slug: "go", Source: "other"}))
+	require.NoError(t, db.Close())
+
+	db, err = boltdatabase.Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	topics := db.GetAllTopics()
+	require.Len(t, topics, 1)
+	require.Equal(t, "Go", topics[0].Title)
+	articles := db.GetAllArticlesForTopic("go")
+	require.Len(t, articles, 1)
+	require.Equal(t, []string{"concurrency"}, articles[0].Tags)
+
+	state, err := db.GetUpdaterState("main")
+	require.NoError(t, err)
+	require.Equal(t, "abc", state.Checksums["go/channels.md"])
+	require.True(t, state.Revisions[0].Live)
+	require.Equal(t, "v2", state.PinnedRevision)
+
+	state, err = db.GetUpdaterState("unknown")
+	require.NoError(t, err)
+	require.Nil(t, state)
+}
+
+func TestDeletesTopicsWithTheirArticles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "content.db")
+	db, err := boltdatabase.Open(path)
+	require.NoError(t, err)
+
+	_, problems := db.ApplyChanges(&model.ContentChanges{
+		Topics: []*model.Topic{{Slug: "go"}, {Slug: "go/generics", ParentSlug: "go"}, {Slug: "rust"}},
+		Articles: []*model.Article{
+			{Slug: "channels", TopicSlug: "go"},
+			{Slug: "constraints", TopicSlug: "go/generics"},
+			{Slug: "traits", TopicSlug: "rust"},
+		},
+	})
+	require.Empty(t, problems)
+	_, problems = db.ApplyChanges(&model.ContentChanges{DeletedTopics: []*model.Topic{{Slug: "go"}}})
+	require.Empty(t, problems)
+	require.NoError(t, db.Close())
+
+	db, err = boltdatabase.Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	require.Len(t, db.GetAllTopics(), 2)
+	// the articles of subtopics are only deleted with their own topic
+	articles := []string{}
+	for _, article := range db.GetAllArticles() {
+		articles = append(articles, article.Slug)
+	}
+	require.ElementsMatch(t, []string{"constraints", "traits"}, articles)
+}
@@ -0,0 +1,310 @@
+package counting
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// dayFormat is the format of the days which views are counted against
+const dayFormat = "2006-01-02"
+
+// botPattern matches the user agents of crawlers, scripts and link previews which are not
+// counted as views
+var botPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|preview|headless|lighthouse|curl|wget|python|java/|go-http-client|okhttp|axios|node-fetch|facebookexternalhit|embedly|monitor`)
+
+// IsBot returns true if the user agent belongs to a crawler or script rather than a reader
+func IsBot(userAgent string) bool {
+	return strings.TrimSpace(userAgent) == "" || botPattern.MatchString(userAgent)
+}
+
+// store is how the views are persisted
+type store struct {
+	// Days holds the views of every article on each day, keyed by "<topic>/<article>"
+	Days map[string]map[string]int `json:"days"`
+	// Totals holds the views of every article since counting began
+	Totals map[string]int `json:"totals"`
+}
+
+// Counter counts views of articles, counting each visitor at most once per article per day.
+// Visitors are identified by a hash of their address and user agent with a salt which changes
+// every day and is never stored, so visitors cannot be identified or followed across days
+type Counter struct {
+	path          string
+	retentionDays int
+	flushInterval time.Duration
+	now           func() time.Time
+
+	store store
+	day   string
+	salt  []byte
+	seen  map[string]struct{}
+	dirty bool
+	lock  sync.Mutex
+
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// Option defines the function used to set options
+type Option func(*Counter)
+
+// WithRetention specifies how many days of views are kept for finding popular articles
+func WithRetention(days int) Option {
+	return func(c *Counter) {
+		c.retentionDays = days
+	}
+}
+
+// WithFlushInterval specifies how often the views are written to the file
+func WithFlushInterval(interval time.Duration) Option {
+	return func(c *Counter) {
+		c.flushInterval = interval
+	}
+}
+
+// WithClock specifies the function used to get the current time
+func WithClock(now func() time.Time) Option {
+	return func(c *Counter) {
+		c.now = now
+	}
+}
+
+// New creates a new counter which keeps its views in the JSON file at the given path. The
+// views are only kept in memory if no path is given
+func New(path string, opts ...Option) (*Counter, error) {
+	c := &Counter{
+		path:          path,
+		retentionDays: 90,
+		flushInterval: time.Minute,
+		now:           time.Now,
+		store: store{
+			Days:   map[string]map[string]int{},
+			Totals: map[string]int{},
+		},
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	go c.run()
+	return c, nil
+}
+
+// Record counts a view of the article by the given visitor, unless they have already viewed
+// it today or they are a bot
+func (c *Counter) Record(topicSlug, articleSlug, visitor, userAgent string) {
+	if IsBot(userAgent) {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.rotate()
+	key := articleKey(topicSlug, articleSlug)
+	seenKey := c.visitorHash(visitor, userAgent) + "|" + key
+	if _, ok := c.seen[seenKey]; ok {
+		return
+	}
+	c.seen[seenKey] = struct{}{}
+
+	if _, ok := c.store.Days[c.day]; !ok {
+		c.store.Days[c.day] = map[string]int{}
+	}
+	c.store.Days[c.day][key]++
+	c.store.Totals[key]++
+	c.dirty = true
+}
+
+// GetViews returns how many times the article has been viewed since counting began
+func (c *Counter) GetViews(topicSlug, articleSlug string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.store.Totals[articleKey(topicSlug, articleSlug)]
+}
+
+// GetPopular returns the most viewed articles within the given window, most viewed first. Every
+// viewed article is returned if the limit is 0
+func (c *Counter) GetPopular(window time.Duration, limit int) []*model.ArticleViews {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// views are counted per day, so any day which overlaps the window is included
+	since := c.now().UTC().Add(-window).Format(dayFormat)
+	views := map[string]int{}
+	for day, articles := range c.store.Days {
+		if day < since {
+			continue
+		}
+		for key, count := range articles {
+			views[key] += count
+		}
+	}
+
+	popular := make([]*model.ArticleViews, 0, len(views))
+	for key, count := range views {
+		// topics may be nested, so only the last part of the key is the article
+		i := strings.LastIndex(key, "/")
+		topicSlug, articleSlug := key[:max(i, 0)], key[i+1:]
+		popular = append(popular, &model.ArticleViews{
+			TopicSlug:   topicSlug,
+			ArticleSlug: articleSlug,
+			Views:       count,
+		})
+	}
+	sort.Slice(popular, func(i, j int) bool {
+		if popular[i].Views != popular[j].Views {
+			return popular[i].Views > popular[j].Views
+		}
+		return articleKey(popular[i].TopicSlug, popular[i].ArticleSlug) < articleKey(popular[j].TopicSlug, popular[j].ArticleSlug)
+	})
+
+	if limit > 0 && len(popular) > limit {
+		popular = popular[:limit]
+	}
+	return popular
+}
+
+// Shutdown stops the counter, writing any unsaved views to the file
+func (c *Counter) Shutdown() {
+	close(c.done)
+	<-c.finished
+}
+
+func (c *Counter) run() {
+	defer close(c.finished)
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.done:
+			c.flush()
+			return
+		}
+	}
+}
+
+// rotate starts a new day with a new salt, forgetting who has been seen and dropping any days
+// which are no longer kept
+func (c *Counter) rotate() {
+	now := c.now().UTC()
+	day := now.Format(dayFormat)
+	if day == c.day {
+		return
+	}
+
+	c.day = day
+	c.seen = map[string]struct{}{}
+	c.salt = make([]byte, 32)
+	if _, err := rand.Read(c.salt); err != nil {
+		slog.Error("failed to generate visitor salt", "error", err)
+	}
+
+	oldest := now.AddDate(0, 0, -c.retentionDays).Format(dayFormat)
+	for storedDay := range c.store.Days {
+		if storedDay < oldest {
+			delete(c.store.Days, storedDay)
+			c.dirty = true
+		}
+	}
+}
+
+func (c *Counter) visitorHash(visitor, userAgent string) string {
+	hash := sha256.New()
+	hash.Write(c.salt)
+	hash.Write([]byte(visitor + "|" + userAgent))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// load reads any views which were previously written to the file
+func (c *Counter) load() error {
+	if c.path == "" {
+		return nil
+	}
+
+	contents, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read views file")
+	}
+
+	loaded := store{}
+	if err := json.Unmarshal(contents, &loaded); err != nil {
+		return errors.Wrap(err, "failed to parse views file")
+	}
+	if loaded.Days != nil {
+		c.store.Days = loaded.Days
+	}
+	if loaded.Totals != nil {
+		c.store.Totals = loaded.Totals
+	}
+	return nil
+}
+
+// flush writes the views to the file if they have changed. The file is replaced in one step so
+// it is never left partially written
+func (c *Counter) flush() {
+	c.lock.Lock()
+	if c.path == "" || !c.dirty {
+		c.lock.Unlock()
+		return
+	}
+	contents, err := json.Marshal(c.store)
+	c.dirty = false
+	c.lock.Unlock()
+	if err != nil {
+		slog.Error("failed to encode views", "error", err)
+		sentry.CaptureException(err)
+		return
+	}
+
+	if err := writeFile(c.path, contents); err != nil {
+		slog.Error("failed to write views file", "path", c.path, "error", err)
+		sentry.CaptureException(err)
+		c.lock.Lock()
+		c.dirty = true
+		c.lock.Unlock()
+	}
+}
+
+func writeFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create views directory")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write views")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "failed to replace views file")
+}
+
+func articleKey(topicSlug, articleSlug string) string {
+	return topicSlug + "/" + articleSlug
+}
@@ -0,0 +1,72 @@
+package counting_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/counting"
+)
+
+const browser = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Safari/605.1.15"
+
+func TestCountsEachVisitorOncePerDay(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	counter, err := counting.New("", counting.WithClock(func() time.Time { return now }))
+	require.NoError(t, err)
+	defer counter.Shutdown()
+
+	counter.Record("go", "channels", "10.0.0.1", browser)
+	counter.Record("go", "channels", "10.0.0.1", browser)
+	counter.Record("go", "channels", "10.0.0.2", browser)
+	counter.Record("go", "channels", "10.0.0.3", "Googlebot/2.1 (+http://www.google.com/bot.html)")
+	counter.Record("go", "channels", "10.0.0.4", "")
+	require.Equal(t, 2, counter.GetViews("go", "channels"))
+
+	// the same visitor is counted again the next day
+	now = now.Add(24 * time.Hour)
+	counter.Record("go", "channels", "10.0.0.1", browser)
+	require.Equal(t, 3, counter.GetViews("go", "channels"))
+}
+
+func TestReturnsPopularArticlesWithinTheWindow(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	counter, err := counting.New("", counting.WithClock(func() time.Time { return now }))
+	require.NoError(t, err)
+	defer counter.Shutdown()
+
+	for _, visitor := range []string{"1", "2", "3"} {
+		counter.Record("go", "old", visitor, browser)
+	}
+
+	now = now.AddDate(0, 0, 10)
+	counter.Record("go", "channels", "1", browser)
+	counter.Record("go", "channels", "2", browser)
+	counter.Record("rust", "traits", "1", browser)
+
+	popular := counter.GetPopular(7*24*time.Hour, 0)
+	require.Len(t, popular, 2)
+	require.Equal(t, "channels", popular[0].ArticleSlug)
+	require.Equal(t, 2, popular[0].Views)
+	require.Equal(t, "traits", popular[1].ArticleSlug)
+
+	popular = counter.GetPopular(30*24*time.Hour, 1)
+	require.Len(t, popular, 1)
+	require.Equal(t, "old", popular[0].ArticleSlug)
+}
+
+func TestPersistsViewsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "views.json")
+	counter, err := counting.New(path)
+	require.NoError(t, err)
+	counter.Record("go", "channels", "10.0.0.1", browser)
+	counter.Shutdown()
+
+	counter, err = counting.New(path)
+	require.NoError(t, err)
+	defer counter.Shutdown()
+	require.Equal(t, 1, counter.GetViews("go", "channels"))
+	require.Len(t, counter.GetPopular(24*time.Hour, 10), 1)
+}
@@ -0,0 +1,187 @@
+package diffing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines defines how many unchanged lines surround each hunk
+const contextLines = 3
+
+type operation int
+
+const (
+	equal operation = iota
+	insert
+	remove
+)
+
+type line struct {
+	op   operation
+	text string
+	// line numbers in the original and updated text, starting at 1
+	from, to int
+}
+
+// Unified returns a unified diff of the changes required to turn the from text into the to text.
+// An empty string is returned when both texts are the same
+func Unified(from, to, fromLabel, toLabel string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var b strings.Builder
+	for _, hunk := range buildHunks(lines) {
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromLabel, toLabel)
+		}
+		writeHunk(&b, hunk)
+	}
+
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// maxCompared limits how many pairs of lines are compared when calculating the longest common
+// subsequence, which needs a table of that size. Changes larger than this are shown as every
+// line being replaced
+const maxCompared = 1 << 20
+
+// diffLines trims the lines both texts share at the start and end, then calculates the
+// operations required to change what is left
+func diffLines(from, to []string) []line {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]line, 0, len(from)+len(to))
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, line{op: equal, text: from[i], from: i + 1, to: i + 1})
+	}
+	lines = append(lines, diffChanged(from[prefix:len(from)-suffix], to[prefix:len(to)-suffix], prefix)...)
+	for i := suffix; i > 0; i-- {
+		lines = append(lines, line{op: equal, text: from[len(from)-i], from: len(from) - i + 1, to: len(to) - i + 1})
+	}
+	return lines
+}
+
+// diffChanged calculates the longest common subsequence of both sets of lines and walks it
+// to produce the list of operations. The offset is the number of lines before them
+func diffChanged(from, to []string, offset int) []line {
+	lines := make([]line, 0, len(from)+len(to))
+	if len(from)*len(to) > maxCompared {
+		for i, text := range from {
+			lines = append(lines, line{op: remove, text: text, from: offset + i + 1, to: offset})
+		}
+		for j, text := range to {
+			lines = append(lines, line{op: insert, text: text, from: offset + len(from), to: offset + j + 1})
+		}
+		return lines
+	}
+
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			lines = append(lines, line{op: equal, text: from[i], from: offset + i + 1, to: offset + j + 1})
+			i++
+			j++
+		case i < len(from) && (j == len(to) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{op: remove, text: from[i], from: offset + i + 1, to: offset + j})
+			i++
+		default:
+			lines = append(lines, line{op: insert, text: to[j], from: offset + i, to: offset + j + 1})
+			j++
+		}
+	}
+	return lines
+}
+
+// buildHunks groups the changed lines along with their surrounding context
+func buildHunks(lines []line) [][]line {
+	hunks := [][]line{}
+	start, end := -1, -1
+	for i, l := range lines {
+		if l.op == equal {
+			continue
+		}
+
+		hunkStart := max(i-contextLines, 0)
+		if start != -1 && hunkStart > end {
+			hunks = append(hunks, lines[start:end])
+			start = -1
+		}
+		if start == -1 {
+			start = hunkStart
+		}
+		end = min(i+contextLines+1, len(lines))
+	}
+
+	if start != -1 {
+		hunks = append(hunks, lines[start:end])
+	}
+	return hunks
+}
+
+func writeHunk(b *strings.Builder, hunk []line) {
+	fromStart, fromCount, toStart, toCount := 0, 0, 0, 0
+	for _, l := range hunk {
+		if l.op != insert {
+			if fromCount == 0 {
+				fromStart = l.from
+			}
+			fromCount++
+		}
+		if l.op != remove {
+			if toCount == 0 {
+				toStart = l.to
+			}
+			toCount++
+		}
+	}
+
+	// an empty range refers to the line before it
+	if fromCount == 0 {
+		fromStart = hunk[0].from
+	}
+	if toCount == 0 {
+		toStart = hunk[0].to
+	}
+
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", fromStart, fromCount, toStart, toCount)
+	for _, l := range hunk {
+		switch l.op {
+		case equal:
+			b.WriteString(" ")
+		case insert:
+			b.WriteString("+")
+		case remove:
+			b.WriteString("-")
+		}
+		b.WriteString(l.text)
+		b.WriteString("\n")
+	}
+}
@@ -0,0 +1,55 @@
+package diffing_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/diffing"
+)
+
+func TestUnifiedReturnsNothingForIdenticalText(t *testing.T) {
+	require.Equal(t, "", diffing.Unified("one\ntwo\n", "one\ntwo\n", "a", "b"))
+}
+
+func TestUnifiedDiffsChangedLines(t *testing.T) {
+	from := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	to := "one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -1,5 +1,5 @@\n one\n-two\n+2\n three\n four\n five\n"+
+		"@@ -8,3 +8,4 @@\n eight\n nine\n ten\n+eleven\n",
+		diffing.Unified(from, to, "a", "b"))
+}
+
+func TestUnifiedDiffsAddedFile(t *testing.T) {
+	require.Equal(t, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+one\n+two\n", diffing.Unified("", "one\ntwo", "a", "b"))
+}
+
+func TestUnifiedOnlyComparesChangedLines(t *testing.T) {
+	lines := make([]string, 10000)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i)
+	}
+	from := strings.Join(lines, "\n")
+	lines[5000] = "changed"
+	to := strings.Join(lines, "\n")
+
+	require.Equal(t, "--- a\n+++ b\n"+
+		"@@ -4998,7 +4998,7 @@\n 4997\n 4998\n 4999\n-5000\n+changed\n 5001\n 5002\n 5003\n",
+		diffing.Unified(from, to, "a", "b"))
+}
+
+func TestUnifiedReplacesLargeChangesWithoutComparingLines(t *testing.T) {
+	from, to := make([]string, 5000), make([]string, 5000)
+	for i := range from {
+		from[i] = fmt.Sprint("from ", i)
+		to[i] = fmt.Sprint("to ", i)
+	}
+
+	diff := diffing.Unified(strings.Join(from, "\n"), strings.Join(to, "\n"), "a", "b")
+	require.True(t, strings.HasPrefix(diff, "--- a\n+++ b\n@@ -1,5000 +1,5000 @@\n-from 0\n"))
+	require.Contains(t, diff, "-from 4999\n+to 0\n")
+	require.True(t, strings.HasSuffix(diff, "+to 4999\n"))
+}
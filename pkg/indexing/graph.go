@@ -0,0 +1,109 @@
+package indexing
+
+import (
+	"sort"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// GetGraph returns how the published topics and articles link together
+func (i *Index) GetGraph() *model.Graph {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.graph
+}
+
+// indexBacklinks indexes the articles which link to each file by the linked filepath. Each
+// article is only included once and links to itself are ignored
+func (i *Index) indexBacklinks(articles []*model.Article) {
+	i.backlinksByFilepath = map[string][]*model.Article{}
+	for _, article := range articles {
+		linked := map[string]bool{article.FilePath: true}
+		for _, link := range article.Links {
+			if linked[link] {
+				continue
+			}
+			linked[link] = true
+			i.backlinksByFilepath[link] = append(i.backlinksByFilepath[link], article)
+		}
+	}
+}
+
+// indexGraph builds the graph of the published content, with an edge for every link between
+// published content and from every article to its topic
+func (i *Index) indexGraph() {
+	graph := &model.Graph{Nodes: []*model.GraphNode{}, Edges: []*model.GraphEdge{}}
+	idsByFilepath := map[string]string{}
+
+	for _, topic := range i.topicsByIdentifier {
+		if topic.Hidden || topic.IsExpired() {
+			continue
+		}
+		idsByFilepath[topic.FilePath] = topicNodeID(topic.Slug)
+		graph.Nodes = append(graph.Nodes, &model.GraphNode{
+			ID:    topicNodeID(topic.Slug),
+			Type:  model.GraphNodeTopic,
+			Title: topic.Title,
+			Slug:  topic.Slug,
+		})
+	}
+
+	for _, article := range i.articlesByTime {
+		if article.Hidden {
+			continue
+		}
+		id := articleNodeID(article.TopicSlug, article.Slug)
+		idsByFilepath[article.FilePath] = id
+		graph.Nodes = append(graph.Nodes, &model.GraphNode{
+			ID:        id,
+			Type:      model.GraphNodeArticle,
+			Title:     article.Title,
+			TopicSlug: article.TopicSlug,
+			Slug:      article.Slug,
+		})
+	}
+
+	for _, article := range i.articlesByTime {
+		id, ok := idsByFilepath[article.FilePath]
+		if !ok {
+			continue
+		}
+		if topic, ok := i.topicsByIdentifier[article.TopicSlug]; ok && !topic.Hidden {
+			graph.Edges = append(graph.Edges, &model.GraphEdge{Source: id, Target: topicNodeID(topic.Slug), Type: model.GraphEdgeTopic})
+		}
+
+		linked := map[string]bool{id: true}
+		for _, link := range article.Links {
+			target, ok := idsByFilepath[link]
+			if !ok || linked[target] {
+				continue
+			}
+			linked[target] = true
+			graph.Edges = append(graph.Edges, &model.GraphEdge{Source: id, Target: target, Type: model.GraphEdgeLink})
+		}
+	}
+
+	// keep the response stable between reindexes
+	sort.Slice(graph.Nodes, func(x, y int) bool {
+		return graph.Nodes[x].ID < graph.Nodes[y].ID
+	})
+	sort.SliceStable(graph.Edges, func(x, y int) bool {
+		if graph.Edges[x].Source != graph.Edges[y].Source {
+			return graph.Edges[x].Source < graph.Edges[y].Source
+		}
+		return graph.Edges[x].Target < graph.Edges[y].Target
+	})
+
+	i.graph = graph
+}
+
+// topicNodeID and articleNodeID are prefixed by the node type, as nested topic slugs and
+// article keys can be the same, e.g. the "go/testing" topic and the testing article in "go"
+func topicNodeID(slug string) string {
+	return model.GraphNodeTopic + ":" + slug
+}
+
+func articleNodeID(topicSlug, slug string) string {
+	return model.GraphNodeArticle + ":" + articleKey(topicSlug, slug)
+}
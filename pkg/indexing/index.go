@@ -1,24 +1,33 @@
 package indexing
 
 import (
+	"context"
 	"log/slog"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/wamphlett/blog-server/pkg/model"
 )
 
+var tracer = otel.Tracer("github.com/wamphlett/blog-server/pkg/indexing")
+
 type Database interface {
 	GetAllTopics() []*model.Topic
 	GetAllArticles() []*model.Article
 }
 
+// ReindexedCallback is called with the changes found by every reindex except the first
 type ReindexedCallback func(result ReindexResults)
 
 type Option func(*Index)
 
+// WithReindexedCallback registers a callback to be called after a reindex
 func WithReindexedCallback(callback ReindexedCallback) Option {
 	return func(i *Index) {
 		i.reindexedCallbacks = append(i.reindexedCallbacks, callback)
@@ -30,11 +39,15 @@ type Metrics interface {
 	Indexed(startTime time.Time, topicCount, articleCount int)
 }
 
+// ReindexResults holds the changes found by a reindex. Articles are only included once they
+// are published, so a scheduled article is new once its publish time has passed
 type ReindexResults struct {
-	NewTopics       []*model.Topic
-	UpdatedTopics   []*model.Topic
-	NewArticles     []*model.Article
-	UpdatedArticles []*model.Article
+	NewTopics           []*model.Topic
+	UpdatedTopics       []*model.Topic
+	NewArticles         []*model.Article
+	UpdatedArticles     []*model.Article
+	UnpublishedArticles []*model.Article
+	ExpiredTopics       []*model.Topic
 }
 
 // Index defines an index
@@ -48,10 +61,28 @@ type Index struct {
 	articlesByTime       []*model.Article
 	articlesByURI        map[string]*model.Article
 	urisByFilepath       map[string]string
+	backlinksByFilepath  map[string][]*model.Article
+	relatedByArticle     map[string][]*model.Article
+	articlesByTopic      map[string][]*model.Article
+	adjacentByArticle    map[string]adjacentArticles
+	seriesByIdentifier   map[string]*model.Series
+	graph                *model.Graph
+	publishedByTopic     map[string]int
 
 	// last indexed time
 	lastIndexed time.Time
 
+	// lock guards the indexes, reindexLock makes sure only one reindex runs at a time
+	lock        sync.RWMutex
+	reindexLock sync.Mutex
+
+	// reindexes when the next scheduled article is published
+	timer       *time.Timer
+	nextReindex time.Time
+	stopped     bool
+
+	relatedCount int
+
 	database Database
 	metrics  Metrics
 }
@@ -59,8 +90,9 @@ type Index struct {
 // NewIndex creates a new index with the required dependencies
 func NewIndex(database Database, metrics Metrics, opts ...Option) *Index {
 	i := &Index{
-		database: database,
-		metrics:  metrics,
+		database:     database,
+		metrics:      metrics,
+		relatedCount: defaultRelatedCount,
 	}
 
 	// apply the options
@@ -72,14 +104,23 @@ func NewIndex(database Database, metrics Metrics, opts ...Option) *Index {
 }
 
 func (i *Index) GetLastIndexedTime() time.Time {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	return i.lastIndexed
 }
 
 func (i *Index) GetTopicByIdentifier(identifier string) *model.Topic {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	return i.topicsByIdentifier[identifier]
 }
 
 func (i *Index) GetArticleByIdentifier(topicIdentidier, identifier string) *model.Article {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	if topicArticles, ok := i.articlesByIdentifier[topicIdentidier]; ok {
 		return topicArticles[identifier]
 	}
@@ -89,6 +130,9 @@ func (i *Index) GetArticleByIdentifier(topicIdentidier, identifier string) *mode
 
 // GetTopics returns all the indexed topics
 func (i *Index) GetAllTopics() []*model.Topic {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	topics := make([]*model.Topic, 0, len(i.topicsByIdentifier))
 	for _, topic := range i.topicsByIdentifier {
 		topics = append(topics, topic)
@@ -97,51 +141,231 @@ func (i *Index) GetAllTopics() []*model.Topic {
 	return topics
 }
 
+// GetAllArticlesForTopic returns every article of the topic in the topic's order
 func (i *Index) GetAllArticlesForTopic(topicIdentifier string) []*model.Article {
-	if _, ok := i.articlesByIdentifier[topicIdentifier]; !ok {
-		return []*model.Article{}
-	}
+	i.lock.RLock()
+	defer i.lock.RUnlock()
 
-	articles := make([]*model.Article, 0, len(i.articlesByIdentifier[topicIdentifier]))
-	for _, article := range i.articlesByIdentifier[topicIdentifier] {
-		articles = append(articles, article)
-	}
+	return append([]*model.Article{}, i.articlesByTopic[topicIdentifier]...)
+}
 
-	return articles
+// GetPublishedArticleCount returns how many articles are published within the topic, including
+// the articles of every topic nested within it
+func (i *Index) GetPublishedArticleCount(topicIdentifier string) int {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.publishedByTopic[topicIdentifier]
 }
 
 // GetURIForFile returns the URI used by the file at the given path
 func (i *Index) GetURIForFile(filepath string) string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	if uri, ok := i.urisByFilepath[filepath]; ok {
 		return uri
 	}
 	return ""
 }
 
+// GetBacklinks returns the articles which link to the file at the given path
+func (i *Index) GetBacklinks(filepath string) []*model.Article {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.backlinksByFilepath[filepath]
+}
+
 func (i *Index) GetRecentArticles(limit int) []*model.Article {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	if limit > len(i.articlesByTime) {
 		limit = len(i.articlesByTime)
 	}
 	return i.articlesByTime[:limit]
 }
 
+// GetNextScheduledReindex returns when the next scheduled article will be published, which is
+// zero if there are none
+func (i *Index) GetNextScheduledReindex() time.Time {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.nextReindex
+}
+
+// Shutdown stops any scheduled reindex
+func (i *Index) Shutdown() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.stopped = true
+	if i.timer != nil {
+		i.timer.Stop()
+	}
+}
+
+// Reindex rebuilds the indexes from the database and schedules another reindex for when the
+// next scheduled article is published
 func (i *Index) Reindex() {
+	i.reindexLock.Lock()
+	defer i.reindexLock.Unlock()
+
+	_, span := tracer.Start(context.Background(), "Index.Reindex")
+	defer span.End()
+
 	startTime := time.Now()
 	slog.Info("reindexing")
 
 	topics := i.database.GetAllTopics()
 	articles := i.database.GetAllArticles()
 
+	i.lock.Lock()
+
+	previousTopics := i.topicsByIdentifier
+	previousArticles := i.articlesByIdentifier
+	previousPublished := make(map[*model.Article]bool, len(i.articlesByTime))
+	for _, article := range i.articlesByTime {
+		previousPublished[article] = true
+	}
+	previousIndexed := i.lastIndexed
+	firstIndex := previousIndexed.IsZero()
+
 	i.indexTopicsByIdentifier(topics)
 	i.indexArticlesByIdentifier(articles)
 	i.indexArticlesByTime(articles)
+	i.indexPublishedCounts()
 	i.indexArticlesByURI(articles)
 	i.indexByURIsByFilepath(topics, articles)
+	i.indexBacklinks(articles)
+	i.indexRelatedArticles(articles)
+	i.indexArticlesByTopic(articles)
+	i.indexSeries()
+	i.indexGraph()
+	i.scheduleReindex(topics, articles)
 
 	i.lastIndexed = startTime
+	i.lock.Unlock()
+
 	i.metrics.Indexed(startTime, len(topics), len(articles))
+	span.SetAttributes(attribute.Int("topics", len(topics)), attribute.Int("articles", len(articles)))
 
 	slog.Info("reindex complete", "topics", len(topics), "articles", len(articles), "duration", time.Since(startTime))
+
+	// everything is new on the first index, so there are no changes to report
+	if firstIndex || len(i.reindexedCallbacks) == 0 {
+		return
+	}
+
+	i.lock.RLock()
+	published := make(map[*model.Article]bool, len(i.articlesByTime))
+	for _, article := range i.articlesByTime {
+		published[article] = true
+	}
+	results := compareIndexes(previousTopics, i.topicsByIdentifier, previousArticles, i.articlesByIdentifier, previousPublished, published, previousIndexed)
+	i.lock.RUnlock()
+	for _, callback := range i.reindexedCallbacks {
+		callback(results)
+	}
+}
+
+// scheduleReindex schedules a reindex for when the next scheduled article is published or the
+// next topic or article expires, so changes happen on time rather than at the next update
+func (i *Index) scheduleReindex(topics []*model.Topic, articles []*model.Article) {
+	if i.timer != nil {
+		i.timer.Stop()
+	}
+	i.nextReindex = time.Time{}
+	if i.stopped {
+		return
+	}
+
+	now := time.Now().Unix()
+	var next int64
+	consider := func(t int64) {
+		if t > now && (next == 0 || t < next) {
+			next = t
+		}
+	}
+	for _, topic := range topics {
+		consider(topic.ExpiresAt)
+	}
+	for _, article := range articles {
+		if article.Hidden {
+			continue
+		}
+		consider(article.PublishedAt)
+		consider(article.ExpiresAt)
+	}
+	if next == 0 {
+		return
+	}
+
+	i.nextReindex = time.Unix(next, 0)
+	slog.Info("scheduled reindex for next publish or expiry", "time", i.nextReindex)
+	// allow a second for the publish time to have definitely passed once the timer fires
+	i.timer = time.AfterFunc(time.Until(i.nextReindex)+time.Second, i.Reindex)
+}
+
+// compareIndexes finds the changes between the previous and current indexes. The updater
+// creates new topics and articles whenever their files change, so anything which is not the
+// same instance has been updated. Whether an article is published is taken from the indexes,
+// as articles with a publish time in the past may not have been indexed as published yet
+func compareIndexes(previousTopics, topics map[string]*model.Topic, previousArticles, articles map[string]map[string]*model.Article,
+	previousPublished, published map[*model.Article]bool, previousIndexed time.Time) ReindexResults {
+	results := ReindexResults{
+		NewTopics:           []*model.Topic{},
+		UpdatedTopics:       []*model.Topic{},
+		NewArticles:         []*model.Article{},
+		UpdatedArticles:     []*model.Article{},
+		UnpublishedArticles: []*model.Article{},
+		ExpiredTopics:       []*model.Topic{},
+	}
+
+	for slug, topic := range topics {
+		previous, ok := previousTopics[slug]
+		switch {
+		case !ok:
+			results.NewTopics = append(results.NewTopics, topic)
+		case previous != topic:
+			results.UpdatedTopics = append(results.UpdatedTopics, topic)
+		}
+
+		// topics which expired since the previous index
+		if ok && topic.IsExpired() && (previous.ExpiresAt == 0 || previous.ExpiresAt > previousIndexed.Unix()) {
+			results.ExpiredTopics = append(results.ExpiredTopics, topic)
+		}
+	}
+
+	for topicSlug, topicArticles := range articles {
+		for slug, article := range topicArticles {
+			previous := previousArticles[topicSlug][slug]
+			wasPublished := previousPublished[previous]
+			switch {
+			case !published[article]:
+				if wasPublished {
+					results.UnpublishedArticles = append(results.UnpublishedArticles, article)
+				}
+			case !wasPublished:
+				results.NewArticles = append(results.NewArticles, article)
+			case previous != article:
+				results.UpdatedArticles = append(results.UpdatedArticles, article)
+			}
+		}
+	}
+
+	// articles which have been removed are no longer published
+	for topicSlug, topicArticles := range previousArticles {
+		for slug, previous := range topicArticles {
+			if _, ok := articles[topicSlug][slug]; !ok && previousPublished[previous] {
+				results.UnpublishedArticles = append(results.UnpublishedArticles, previous)
+			}
+		}
+	}
+
+	return results
 }
 
 func (i *Index) indexArticlesByTime(articles []*model.Article) {
@@ -151,6 +375,10 @@ func (i *Index) indexArticlesByTime(articles []*model.Article) {
 		if !article.IsPublished() {
 			continue
 		}
+		// the articles of an expired topic are no longer published
+		if topic, ok := i.topicsByIdentifier[article.TopicSlug]; ok && topic.IsExpired() {
+			continue
+		}
 		i.articlesByTime = append(i.articlesByTime, article)
 	}
 
@@ -159,6 +387,22 @@ func (i *Index) indexArticlesByTime(articles []*model.Article) {
 	})
 }
 
+// indexPublishedCounts counts the published articles of each topic along with those of the
+// topics nested within it
+func (i *Index) indexPublishedCounts() {
+	i.publishedByTopic = map[string]int{}
+	for _, article := range i.articlesByTime {
+		for slug := article.TopicSlug; slug != ""; {
+			i.publishedByTopic[slug]++
+			topic, ok := i.topicsByIdentifier[slug]
+			if !ok {
+				break
+			}
+			slug = topic.ParentSlug
+		}
+	}
+}
+
 func (i *Index) indexTopicsByIdentifier(topics []*model.Topic) {
 	i.topicsByIdentifier = make(map[string]*model.Topic, len(topics))
 	for _, topic := range topics {
@@ -0,0 +1,309 @@
+package indexing_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/indexing"
+	"github.com/wamphlett/blog-server/pkg/invalidating"
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+type database struct {
+	topics   []*model.Topic
+	articles []*model.Article
+}
+
+func (d *database) GetAllTopics() []*model.Topic     { return d.topics }
+func (d *database) GetAllArticles() []*model.Article { return d.articles }
+
+type noopMetrics struct{}
+
+func (noopMetrics) Indexed(startTime time.Time, topicCount, articleCount int) {}
+
+func TestReindexesWhenArticlesArePublishedAndExpire(t *testing.T) {
+	now := time.Now().Unix()
+	scheduled := &model.Article{Slug: "scheduled", TopicSlug: "topic", PublishedAt: now + 1}
+	expiring := &model.Article{Slug: "expiring", TopicSlug: "topic", PublishedAt: now - 60, ExpiresAt: now + 1}
+	db := &database{
+		topics:   []*model.Topic{{Slug: "topic"}},
+		articles: []*model.Article{scheduled, expiring},
+	}
+
+	lock := sync.Mutex{}
+	results := []indexing.ReindexResults{}
+	index := indexing.NewIndex(db, noopMetrics{}, indexing.WithReindexedCallback(func(result indexing.ReindexResults) {
+		lock.Lock()
+		defer lock.Unlock()
+		results = append(results, result)
+	}))
+	defer index.Shutdown()
+
+	index.Reindex()
+	require.Equal(t, []*model.Article{expiring}, index.GetRecentArticles(10))
+	require.Equal(t, time.Unix(now+1, 0), index.GetNextScheduledReindex())
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(results) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.Equal(t, []*model.Article{scheduled}, index.GetRecentArticles(10))
+	require.Equal(t, []*model.Article{scheduled}, results[0].NewArticles)
+	require.Equal(t, []*model.Article{expiring}, results[0].UnpublishedArticles)
+	require.True(t, index.GetNextScheduledReindex().IsZero())
+}
+
+func TestFindsRelatedArticles(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	golang := &model.Article{Slug: "golang", TopicSlug: "code", PublishedAt: published, Tags: []string{"go"},
+		Terms: map[string]int{"goroutines": 3, "channels": 2}}
+	channels := &model.Article{Slug: "channels", TopicSlug: "code", PublishedAt: published, Tags: []string{"go"},
+		Terms: map[string]int{"channels": 4, "goroutines": 1}}
+	rust := &model.Article{Slug: "rust", TopicSlug: "code", PublishedAt: published, Tags: []string{"rust"},
+		Terms: map[string]int{"ownership": 2}}
+	baking := &model.Article{Slug: "baking", TopicSlug: "food", PublishedAt: published, Tags: []string{"bread"},
+		Terms: map[string]int{"flour": 2}, Related: []string{"code/rust", "missing"}}
+	hidden := &model.Article{Slug: "hidden", TopicSlug: "code", PublishedAt: published, Hidden: true, Tags: []string{"go"},
+		Terms: map[string]int{"goroutines": 3, "channels": 2}}
+	db := &database{
+		topics:   []*model.Topic{{Slug: "code"}, {Slug: "food"}},
+		articles: []*model.Article{golang, channels, rust, baking, hidden},
+	}
+
+	index := indexing.NewIndex(db, noopMetrics{}, indexing.WithRelatedCount(2))
+	defer index.Shutdown()
+	index.Reindex()
+
+	require.Equal(t, []*model.Article{channels, rust}, index.GetRelatedArticles("code", "golang"))
+	// articles in the related header come first, then anything else with something in common
+	require.Equal(t, []*model.Article{rust}, index.GetRelatedArticles("food", "baking"))
+	require.Empty(t, index.GetRelatedArticles("code", "missing"))
+}
+
+func TestIgnoresDuplicateTagsWhenFindingRelatedArticles(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	article := &model.Article{Slug: "article", TopicSlug: "code", PublishedAt: published, Tags: []string{"go", "web"}}
+	// one of two distinct tags in common, however many times they are repeated
+	repeated := &model.Article{Slug: "repeated", TopicSlug: "code", PublishedAt: published, Tags: []string{"go", "Go", "go", "cli"}}
+	// one of three distinct tags in common
+	distinct := &model.Article{Slug: "distinct", TopicSlug: "code", PublishedAt: published, Tags: []string{"go", "cli", "db"}}
+	db := &database{
+		topics:   []*model.Topic{{Slug: "code"}},
+		articles: []*model.Article{article, repeated, distinct},
+	}
+
+	index := indexing.NewIndex(db, noopMetrics{})
+	defer index.Shutdown()
+	index.Reindex()
+
+	require.Equal(t, []*model.Article{repeated, distinct}, index.GetRelatedArticles("code", "article"))
+}
+
+func TestOrdersArticlesWithinTopicsAndSeries(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	first := &model.Article{Slug: "first", TopicSlug: "tutorial", FilePath: "tutorial/first.md", PublishedAt: published + 2, Series: "Learning Go"}
+	second := &model.Article{Slug: "second", TopicSlug: "tutorial", FilePath: "tutorial/second.md", PublishedAt: published + 1}
+	third := &model.Article{Slug: "third", TopicSlug: "tutorial", FilePath: "tutorial/third.md", PublishedAt: published, Series: "Learning Go"}
+	draft := &model.Article{Slug: "draft", TopicSlug: "tutorial", FilePath: "tutorial/draft.md"}
+	pinned := &model.Article{Slug: "pinned", TopicSlug: "tutorial", FilePath: "tutorial/pinned.md", PublishedAt: published, Order: 1}
+	other := &model.Article{Slug: "other", TopicSlug: "other", PublishedAt: published + 3, Series: "learning go", Order: 1}
+	db := &database{
+		topics: []*model.Topic{
+			{Slug: "tutorial", Order: model.OrderList, OrderedFiles: []string{"tutorial/first.md", "tutorial/second.md", "tutorial/draft.md"}},
+			{Slug: "other", Order: model.OrderPublished},
+		},
+		articles: []*model.Article{third, draft, second, other, first, pinned},
+	}
+
+	index := indexing.NewIndex(db, noopMetrics{})
+	defer index.Shutdown()
+	index.Reindex()
+
+	require.Equal(t, []*model.Article{pinned, first, second, draft, third}, index.GetAllArticlesForTopic("tutorial"))
+
+	// unpublished articles are skipped
+	previous, next := index.GetAdjacentArticles("tutorial", "second")
+	require.Equal(t, first, previous)
+	require.Equal(t, third, next)
+	previous, next = index.GetAdjacentArticles("tutorial", "pinned")
+	require.Nil(t, previous)
+	require.Equal(t, first, next)
+
+	series := index.GetSeriesByIdentifier("learning-go")
+	require.NotNil(t, series)
+	require.Equal(t, "learning go", series.Title)
+	require.Equal(t, []*model.Article{other, third, first}, series.Articles)
+	require.Len(t, index.GetAllSeries(), 1)
+}
+
+func TestBuildsLinkGraph(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	intro := &model.Article{Slug: "intro", TopicSlug: "go", FilePath: "go/intro.md", PublishedAt: published,
+		Links: []string{"go/next.md", "go/next.md", "go/intro.md", "go/draft.md", "go/README.md"}}
+	next := &model.Article{Slug: "next", TopicSlug: "go", FilePath: "go/next.md", PublishedAt: published}
+	draft := &model.Article{Slug: "draft", TopicSlug: "go", FilePath: "go/draft.md", Links: []string{"go/next.md"}}
+	db := &database{
+		topics:   []*model.Topic{{Slug: "go", FilePath: "go/README.md", Title: "Go"}},
+		articles: []*model.Article{intro, next, draft},
+	}
+
+	index := indexing.NewIndex(db, noopMetrics{})
+	defer index.Shutdown()
+	index.Reindex()
+
+	require.Equal(t, []*model.Article{intro, draft}, index.GetBacklinks("go/next.md"))
+	require.Empty(t, index.GetBacklinks("go/intro.md"))
+
+	graph := index.GetGraph()
+	require.Equal(t, []*model.GraphNode{
+		{ID: "article:go/intro", Type: model.GraphNodeArticle, TopicSlug: "go", Slug: "intro"},
+		{ID: "article:go/next", Type: model.GraphNodeArticle, TopicSlug: "go", Slug: "next"},
+		{ID: "topic:go", Type: model.GraphNodeTopic, Title: "Go", Slug: "go"},
+	}, graph.Nodes)
+	require.Equal(t, []*model.GraphEdge{
+		{Source: "article:go/intro", Target: "article:go/next", Type: model.GraphEdgeLink},
+		{Source: "article:go/intro", Target: "topic:go", Type: model.GraphEdgeTopic},
+		{Source: "article:go/intro", Target: "topic:go", Type: model.GraphEdgeLink},
+		{Source: "article:go/next", Target: "topic:go", Type: model.GraphEdgeTopic},
+	}, graph.Edges)
+
+	// a nested topic never shares an ID with the article of the same path
+	article := &model.Article{Slug: "testing", TopicSlug: "go", FilePath: "go/testing.md", PublishedAt: published,
+		Links: []string{"go/testing/README.md"}}
+	nested := &model.Article{Slug: "mocks", TopicSlug: "go/testing", FilePath: "go/testing/mocks.md", PublishedAt: published,
+		Links: []string{"go/testing.md"}}
+	db = &database{
+		topics: []*model.Topic{
+			{Slug: "go", FilePath: "go/README.md", Children: []string{"go/testing"}},
+			{Slug: "go/testing", ParentSlug: "go", FilePath: "go/testing/README.md"},
+		},
+		articles: []*model.Article{article, nested},
+	}
+
+	nestedIndex := indexing.NewIndex(db, noopMetrics{})
+	defer nestedIndex.Shutdown()
+	nestedIndex.Reindex()
+
+	graph = nestedIndex.GetGraph()
+	ids := []string{}
+	for _, node := range graph.Nodes {
+		ids = append(ids, node.ID)
+	}
+	require.Equal(t, []string{"article:go/testing", "article:go/testing/mocks", "topic:go", "topic:go/testing"}, ids)
+	require.Equal(t, []*model.GraphEdge{
+		{Source: "article:go/testing", Target: "topic:go", Type: model.GraphEdgeTopic},
+		{Source: "article:go/testing", Target: "topic:go/testing", Type: model.GraphEdgeLink},
+		{Source: "article:go/testing/mocks", Target: "article:go/testing", Type: model.GraphEdgeLink},
+		{Source: "article:go/testing/mocks", Target: "topic:go/testing", Type: model.GraphEdgeTopic},
+	}, graph.Edges)
+}
+
+func TestReportsArticlesWhenTheyBecomeVisible(t *testing.T) {
+	now := time.Now().Unix()
+	scheduled := &model.Article{Slug: "scheduled", TopicSlug: "topic", URI: "/topics/topic/articles/scheduled", FilePath: "topic/scheduled.md", PublishedAt: now + 1, Tags: []string{"go"}}
+	linking := &model.Article{Slug: "linking", TopicSlug: "topic", URI: "/topics/topic/articles/linking", FilePath: "topic/linking.md", PublishedAt: now - 60, Links: []string{"topic/scheduled.md"}}
+	db := &database{
+		topics:   []*model.Topic{{Slug: "topic", URI: "/topics/topic"}},
+		articles: []*model.Article{scheduled, linking},
+	}
+
+	results := make(chan indexing.ReindexResults, 1)
+	index := indexing.NewIndex(db, noopMetrics{}, indexing.WithReindexedCallback(func(result indexing.ReindexResults) {
+		results <- result
+	}))
+	defer index.Shutdown()
+
+	// nothing is reported by the first index
+	index.Reindex()
+	require.Empty(t, results)
+
+	var result indexing.ReindexResults
+	select {
+	case result = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled article was not published")
+	}
+
+	require.Equal(t, []*model.Article{scheduled}, result.NewArticles)
+	require.Empty(t, result.NewTopics)
+	require.Empty(t, result.UpdatedTopics)
+	require.Empty(t, result.UpdatedArticles)
+	require.Empty(t, result.UnpublishedArticles)
+
+	// the published article's pages are invalidated along with the pages which show it
+	dependencies := invalidating.NewDependencies(index)
+	require.Equal(t, []string{
+		"/",
+		"/overview",
+		"/recent",
+		"/tags/go",
+		"/topics",
+		"/topics/topic",
+		"/topics/topic/articles/linking",
+		"/topics/topic/articles/scheduled",
+	}, dependencies.AffectedPaths(result.ExpiredTopics, result.NewArticles))
+}
+
+func TestReportsChangesBetweenReindexes(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	unchanged := &model.Article{Slug: "unchanged", TopicSlug: "topic", PublishedAt: published}
+	updated := &model.Article{Slug: "updated", TopicSlug: "topic", PublishedAt: published}
+	removed := &model.Article{Slug: "removed", TopicSlug: "topic", PublishedAt: published}
+	hidden := &model.Article{Slug: "hidden", TopicSlug: "topic", PublishedAt: published}
+	db := &database{
+		topics:   []*model.Topic{{Slug: "topic"}},
+		articles: []*model.Article{unchanged, updated, removed, hidden},
+	}
+
+	results := []indexing.ReindexResults{}
+	index := indexing.NewIndex(db, noopMetrics{}, indexing.WithReindexedCallback(func(result indexing.ReindexResults) {
+		results = append(results, result)
+	}))
+	defer index.Shutdown()
+	index.Reindex()
+
+	// the updater replaces the articles whose files change
+	newTopic := &model.Topic{Slug: "new"}
+	newArticle := &model.Article{Slug: "article", TopicSlug: "new", PublishedAt: published}
+	updatedAgain := &model.Article{Slug: "updated", TopicSlug: "topic", PublishedAt: published, Title: "Updated"}
+	hiddenAgain := &model.Article{Slug: "hidden", TopicSlug: "topic", PublishedAt: published, Hidden: true}
+	db.topics = append(db.topics, newTopic)
+	db.articles = []*model.Article{unchanged, updatedAgain, hiddenAgain, newArticle}
+	index.Reindex()
+
+	require.Len(t, results, 1)
+	require.Equal(t, []*model.Topic{newTopic}, results[0].NewTopics)
+	require.Empty(t, results[0].UpdatedTopics)
+	require.Equal(t, []*model.Article{newArticle}, results[0].NewArticles)
+	require.Equal(t, []*model.Article{updatedAgain}, results[0].UpdatedArticles)
+	require.ElementsMatch(t, []*model.Article{hiddenAgain, removed}, results[0].UnpublishedArticles)
+}
+
+func TestShutdownStopsScheduledReindexes(t *testing.T) {
+	db := &database{
+		topics:   []*model.Topic{{Slug: "topic"}},
+		articles: []*model.Article{{Slug: "scheduled", TopicSlug: "topic", PublishedAt: time.Now().Unix() + 1}},
+	}
+
+	lock := sync.Mutex{}
+	reindexed := false
+	index := indexing.NewIndex(db, noopMetrics{}, indexing.WithReindexedCallback(func(result indexing.ReindexResults) {
+		lock.Lock()
+		defer lock.Unlock()
+		reindexed = true
+	}))
+	index.Reindex()
+	require.False(t, index.GetNextScheduledReindex().IsZero())
+
+	index.Shutdown()
+	require.Never(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return reindexed
+	}, 3*time.Second, 100*time.Millisecond)
+	require.Empty(t, index.GetRecentArticles(10))
+}
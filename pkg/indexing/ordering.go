@@ -0,0 +1,155 @@
+package indexing
+
+import (
+	"sort"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// adjacentArticles holds the published articles either side of an article within its topic
+type adjacentArticles struct {
+	previous *model.Article
+	next     *model.Article
+}
+
+// GetAdjacentArticles returns the published articles before and after the given article within
+// its topic, either of which is nil at the start or end of the topic
+func (i *Index) GetAdjacentArticles(topicIdentifier, identifier string) (previous, next *model.Article) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	adjacent := i.adjacentByArticle[articleKey(topicIdentifier, identifier)]
+	return adjacent.previous, adjacent.next
+}
+
+// GetAllSeries returns every series with published articles, ordered by title
+func (i *Index) GetAllSeries() []*model.Series {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	series := make([]*model.Series, 0, len(i.seriesByIdentifier))
+	for _, s := range i.seriesByIdentifier {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(x, y int) bool {
+		return series[x].Title < series[y].Title
+	})
+
+	return series
+}
+
+// GetSeriesByIdentifier returns the series with the given slug
+func (i *Index) GetSeriesByIdentifier(identifier string) *model.Series {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.seriesByIdentifier[identifier]
+}
+
+// indexArticlesByTopic orders the articles of each topic and finds the published articles
+// either side of each article
+func (i *Index) indexArticlesByTopic(articles []*model.Article) {
+	i.articlesByTopic = map[string][]*model.Article{}
+	for _, article := range articles {
+		i.articlesByTopic[article.TopicSlug] = append(i.articlesByTopic[article.TopicSlug], article)
+	}
+
+	published := make(map[*model.Article]bool, len(i.articlesByTime))
+	for _, article := range i.articlesByTime {
+		published[article] = true
+	}
+
+	i.adjacentByArticle = map[string]adjacentArticles{}
+	for topicSlug, topicArticles := range i.articlesByTopic {
+		sortArticles(i.topicsByIdentifier[topicSlug], topicArticles)
+
+		topicPublished := []*model.Article{}
+		for _, article := range topicArticles {
+			if published[article] {
+				topicPublished = append(topicPublished, article)
+			}
+		}
+		for position, article := range topicPublished {
+			adjacent := adjacentArticles{}
+			if position > 0 {
+				adjacent.previous = topicPublished[position-1]
+			}
+			if position < len(topicPublished)-1 {
+				adjacent.next = topicPublished[position+1]
+			}
+			i.adjacentByArticle[articleKey(topicSlug, article.Slug)] = adjacent
+		}
+	}
+}
+
+// indexSeries groups the published articles by their series
+func (i *Index) indexSeries() {
+	i.seriesByIdentifier = map[string]*model.Series{}
+	for _, article := range i.articlesByTime {
+		slug := article.SeriesSlug()
+		if slug == "" {
+			continue
+		}
+		if _, ok := i.seriesByIdentifier[slug]; !ok {
+			i.seriesByIdentifier[slug] = &model.Series{Title: article.Series, Slug: slug}
+		}
+		i.seriesByIdentifier[slug].Articles = append(i.seriesByIdentifier[slug].Articles, article)
+	}
+
+	for _, series := range i.seriesByIdentifier {
+		sortArticles(nil, series.Articles)
+		// the title is taken from the first article so it does not depend on the index order
+		series.Title = series.Articles[0].Series
+	}
+}
+
+// sortArticles orders the articles by their order header, then by how the topic is ordered.
+// Without a topic, the articles are ordered by when they were published
+func sortArticles(topic *model.Topic, articles []*model.Article) {
+	order := model.OrderPublished
+	listed := map[string]int{}
+	if topic != nil {
+		order = topic.Order
+		for position, file := range topic.OrderedFiles {
+			if _, ok := listed[file]; !ok {
+				listed[file] = position
+			}
+		}
+	}
+
+	sort.SliceStable(articles, func(x, y int) bool {
+		a, b := articles[x], articles[y]
+		// articles with an order header come first
+		if (a.Order > 0) != (b.Order > 0) {
+			return a.Order > 0
+		}
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+
+		switch order {
+		case model.OrderList:
+			positionA, listedA := listed[a.FilePath]
+			positionB, listedB := listed[b.FilePath]
+			if listedA != listedB {
+				return listedA
+			}
+			if positionA != positionB {
+				return positionA < positionB
+			}
+		case model.OrderPriority:
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+		}
+
+		// articles without a publish date come last
+		if (a.PublishedAt > 0) != (b.PublishedAt > 0) {
+			return a.PublishedAt > 0
+		}
+		if a.PublishedAt != b.PublishedAt {
+			return a.PublishedAt < b.PublishedAt
+		}
+		return a.Slug < b.Slug
+	})
+}
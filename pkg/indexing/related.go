@@ -0,0 +1,175 @@
+package indexing
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// defaultRelatedCount is how many related articles are kept for each article
+const defaultRelatedCount = 3
+
+// weights given to each signal when scoring how related two articles are
+const (
+	tagWeight   = 0.4
+	topicWeight = 0.2
+	termWeight  = 0.4
+)
+
+// WithRelatedCount sets how many related articles are kept for each article
+func WithRelatedCount(count int) Option {
+	return func(i *Index) {
+		i.relatedCount = count
+	}
+}
+
+// GetRelatedArticles returns the articles most related to the given article, most related first
+func (i *Index) GetRelatedArticles(topicIdentifier, identifier string) []*model.Article {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.relatedByArticle[articleKey(topicIdentifier, identifier)]
+}
+
+// indexRelatedArticles finds the related articles of every article. Articles given in the related
+// header come first, then the published articles which share the most tags, topic and terms
+func (i *Index) indexRelatedArticles(articles []*model.Article) {
+	i.relatedByArticle = make(map[string][]*model.Article, len(articles))
+	if i.relatedCount <= 0 {
+		return
+	}
+
+	published := make(map[*model.Article]bool, len(i.articlesByTime))
+	for _, article := range i.articlesByTime {
+		published[article] = true
+	}
+	weights := idf(i.articlesByTime)
+	vectors := make(map[*model.Article]map[string]float64, len(i.articlesByTime))
+	for _, article := range i.articlesByTime {
+		vectors[article] = termVector(article.Terms, weights)
+	}
+
+	for _, article := range articles {
+		related := []*model.Article{}
+		seen := map[*model.Article]bool{article: true}
+		for _, ref := range article.Related {
+			// topics may be nested, so only the last part of the reference is the article
+			topicSlug, slug := article.TopicSlug, ref
+			if slash := strings.LastIndex(ref, "/"); slash >= 0 {
+				topicSlug, slug = ref[:slash], ref[slash+1:]
+			}
+			other := i.articlesByIdentifier[topicSlug][slug]
+			if other == nil || !published[other] || seen[other] || len(related) >= i.relatedCount {
+				continue
+			}
+			seen[other] = true
+			related = append(related, other)
+		}
+
+		type candidate struct {
+			article *model.Article
+			score   float64
+		}
+		candidates := []candidate{}
+		vector := vectors[article]
+		if vector == nil {
+			// unpublished articles still have related articles for previews
+			vector = termVector(article.Terms, weights)
+		}
+		for _, other := range i.articlesByTime {
+			if seen[other] {
+				continue
+			}
+			score := tagWeight*jaccard(article.Tags, other.Tags) + termWeight*cosine(vector, vectors[other])
+			if article.TopicSlug == other.TopicSlug {
+				score += topicWeight
+			}
+			if score > 0 {
+				candidates = append(candidates, candidate{other, score})
+			}
+		}
+		sort.SliceStable(candidates, func(x, y int) bool {
+			return candidates[x].score > candidates[y].score
+		})
+		for _, c := range candidates {
+			if len(related) >= i.relatedCount {
+				break
+			}
+			related = append(related, c.article)
+		}
+
+		i.relatedByArticle[articleKey(article.TopicSlug, article.Slug)] = related
+	}
+}
+
+// idf returns the inverse document frequency of every term used by the given articles
+func idf(articles []*model.Article) map[string]float64 {
+	frequency := map[string]int{}
+	for _, article := range articles {
+		for term := range article.Terms {
+			frequency[term]++
+		}
+	}
+
+	weights := make(map[string]float64, len(frequency))
+	for term, count := range frequency {
+		weights[term] = math.Log(float64(1+len(articles))/float64(1+count)) + 1
+	}
+	return weights
+}
+
+func termVector(terms map[string]int, weights map[string]float64) map[string]float64 {
+	vector := make(map[string]float64, len(terms))
+	for term, count := range terms {
+		weight, ok := weights[term]
+		if !ok {
+			continue
+		}
+		vector[term] = float64(count) * weight
+	}
+	return vector
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for term, weight := range a {
+		dot += weight * b[term]
+		normA += weight * weight
+	}
+	for _, weight := range b {
+		normB += weight * weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func jaccard(a, b []string) float64 {
+	setA, setB := tagSet(a), tagSet(b)
+	if len(setA) == 0 || len(setB) == 0 {
+		return 0
+	}
+	shared := 0
+	for tag := range setB {
+		if setA[tag] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
+
+// tagSet returns the distinct tags, ignoring case
+func tagSet(tags []string) map[string]bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[strings.ToLower(tag)] = true
+	}
+	return set
+}
+
+func articleKey(topicSlug, slug string) string {
+	return topicSlug + "/" + slug
+}
@@ -0,0 +1,103 @@
+package invalidating
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PurgeMode defines what a CDN is asked to purge
+type PurgeMode string
+
+const (
+	// PurgeByURL purges the full URL of every path
+	PurgeByURL PurgeMode = "url"
+	// PurgeByKey purges every response tagged with the path as a surrogate key or cache tag
+	PurgeByKey PurgeMode = "key"
+)
+
+// ParsePurgeMode returns the purge mode with the given name, defaulting to purging by URL
+func ParsePurgeMode(mode string) (PurgeMode, error) {
+	switch PurgeMode(mode) {
+	case "", PurgeByURL:
+		return PurgeByURL, nil
+	case PurgeByKey:
+		return PurgeByKey, nil
+	}
+	return "", errors.Errorf("unknown purge mode: %s", mode)
+}
+
+// cloudflareMaxPurge is the most files or tags Cloudflare accepts in a single purge request
+const cloudflareMaxPurge = 30
+
+// CloudflareInvalidator purges paths from a Cloudflare zone
+type CloudflareInvalidator struct {
+	apiURL     string
+	zoneID     string
+	token      string
+	siteURL    string
+	mode       PurgeMode
+	httpClient *http.Client
+}
+
+// NewCloudflareInvalidator creates a new invalidator for the given zone. Purging by URL
+// requires the site URL, which every path is appended to
+func NewCloudflareInvalidator(apiURL, zoneID, token, siteURL string, mode PurgeMode) *CloudflareInvalidator {
+	if apiURL == "" {
+		apiURL = "https://api.cloudflare.com/client/v4"
+	}
+	return &CloudflareInvalidator{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		zoneID:     zoneID,
+		token:      token,
+		siteURL:    siteURL,
+		mode:       mode,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Invalidate purges the given paths, split into as many requests as required. The paths of
+// any request which fails are returned as PathErrors
+func (i *CloudflareInvalidator) Invalidate(ctx context.Context, paths []string) error {
+	failed := PathErrors{}
+	for start := 0; start < len(paths); start += cloudflareMaxPurge {
+		end := min(start+cloudflareMaxPurge, len(paths))
+		if err := i.purge(ctx, paths[start:end]); err != nil {
+			for _, path := range paths[start:end] {
+				failed[path] = err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (i *CloudflareInvalidator) purge(ctx context.Context, paths []string) error {
+	slog.Info("purging cloudflare cache", "zone", i.zoneID, "paths", paths)
+	payload := map[string][]string{"tags": paths}
+	if i.mode == PurgeByURL {
+		payload = map[string][]string{"files": joinURLs(i.siteURL, paths)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cloudflare purge request")
+	}
+
+	url := fmt.Sprintf("%s/zones/%s/purge_cache", i.apiURL, i.zoneID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create cloudflare purge request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+i.token)
+
+	return do(i.httpClient, req, fmt.Sprintf("%d paths from cloudflare", len(paths)))
+}
@@ -0,0 +1,128 @@
+package invalidating
+
+import (
+	"path"
+	"sort"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// Graph defines the methods required to find the content which links to other content
+type Graph interface {
+	GetBacklinks(filePath string) []*model.Article
+	GetURIForFile(filePath string) string
+}
+
+// Dependencies works out which paths show a piece of content, so every page affected by a
+// change is invalidated rather than just the page of the content which changed
+type Dependencies struct {
+	graph         Graph
+	listingPaths  []string
+	tagPathPrefix string
+}
+
+// DependenciesOption defines the function used to set dependency options
+type DependenciesOption func(*Dependencies)
+
+// WithListingPaths specifies the paths which list content, such as the home page or feeds,
+// which are affected by every change
+func WithListingPaths(paths ...string) DependenciesOption {
+	return func(d *Dependencies) {
+		d.listingPaths = paths
+	}
+}
+
+// WithTagPathPrefix specifies the path which tag pages are found under. An empty prefix
+// disables tag pages
+func WithTagPathPrefix(prefix string) DependenciesOption {
+	return func(d *Dependencies) {
+		d.tagPathPrefix = prefix
+	}
+}
+
+// NewDependencies creates a new dependency resolver using the given link graph
+func NewDependencies(graph Graph, opts ...DependenciesOption) *Dependencies {
+	d := &Dependencies{
+		graph:         graph,
+		listingPaths:  []string{"/", "/topics", "/recent", "/overview"},
+		tagPathPrefix: "/tags",
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// ListingPaths returns the paths which list content
+func (d *Dependencies) ListingPaths() []string {
+	return d.listingPaths
+}
+
+// AffectedPaths returns every path affected by a change to the given topics and articles. To
+// invalidate pages which no longer show an article, such as a tag it was removed from, include
+// both the previous and current versions of the article
+func (d *Dependencies) AffectedPaths(topics []*model.Topic, articles []*model.Article) []string {
+	if len(topics) == 0 && len(articles) == 0 {
+		return []string{}
+	}
+
+	paths := map[string]bool{}
+	for _, listingPath := range d.listingPaths {
+		paths[listingPath] = true
+	}
+
+	for _, topic := range topics {
+		paths[topic.URI] = true
+		// parent topics list their children
+		for _, parentPath := range topicPaths(topic.ParentSlug) {
+			paths[parentPath] = true
+		}
+	}
+
+	for _, article := range articles {
+		paths[article.URI] = true
+		// the topic page lists the article and shows the article count, which the pages of the
+		// topics it is nested within include too
+		for _, topicPath := range topicPaths(article.TopicSlug) {
+			paths[topicPath] = true
+		}
+
+		if d.tagPathPrefix != "" {
+			for _, tag := range article.Tags {
+				paths[path.Join(d.tagPathPrefix, tag)] = true
+			}
+		}
+
+		// pages which link to the article render its URI, which may have changed
+		for _, backlink := range d.graph.GetBacklinks(article.FilePath) {
+			paths[backlink.URI] = true
+		}
+
+		// pages which the article links to list it as a backlink
+		for _, link := range article.Links {
+			if uri := d.graph.GetURIForFile(link); uri != "" {
+				paths[uri] = true
+			}
+		}
+	}
+
+	affected := make([]string, 0, len(paths))
+	for p := range paths {
+		affected = append(affected, p)
+	}
+	sort.Strings(affected)
+	return affected
+}
+
+// topicPaths returns the path of the topic with the given slug along with the paths of every
+// topic it is nested within
+func topicPaths(slug string) []string {
+	paths := []string{}
+	for ; slug != "" && slug != "." && slug != "/"; slug = path.Dir(slug) {
+		paths = append(paths, path.Join("/topics", slug))
+	}
+	return paths
+}
@@ -0,0 +1,63 @@
+package invalidating_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/invalidating"
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+type graph map[string][]*model.Article
+
+func (g graph) GetBacklinks(filePath string) []*model.Article {
+	return g[filePath]
+}
+
+func (g graph) GetURIForFile(filePath string) string {
+	if filePath == "/content/two/linked.md" {
+		return "/topics/two/articles/linked"
+	}
+	return ""
+}
+
+func TestAffectedPathsIncludesDependentPages(t *testing.T) {
+	linking := &model.Article{URI: "/topics/other/articles/linking", TopicSlug: "other"}
+	dependencies := invalidating.NewDependencies(graph{"/content/one/article.md": {linking}})
+
+	previous := &model.Article{URI: "/topics/one/articles/article", TopicSlug: "one", FilePath: "/content/one/article.md", Tags: []string{"old"}}
+	current := &model.Article{URI: "/topics/one/articles/article", TopicSlug: "one", FilePath: "/content/one/article.md", Tags: []string{"go"},
+		Links: []string{"/content/two/linked.md", "/content/missing.md"}}
+
+	require.Equal(t, []string{
+		"/",
+		"/overview",
+		"/recent",
+		"/tags/go",
+		"/tags/old",
+		"/topics",
+		"/topics/one",
+		"/topics/one/articles/article",
+		"/topics/other/articles/linking",
+		"/topics/two/articles/linked",
+	}, dependencies.AffectedPaths(nil, []*model.Article{previous, current}))
+}
+
+func TestAffectedPathsIsEmptyWithoutChanges(t *testing.T) {
+	dependencies := invalidating.NewDependencies(graph{})
+	require.Empty(t, dependencies.AffectedPaths(nil, nil))
+}
+
+func TestAffectedPathsIncludesParentTopics(t *testing.T) {
+	dependencies := invalidating.NewDependencies(graph{}, invalidating.WithListingPaths())
+
+	topic := &model.Topic{URI: "/topics/guides/go", Slug: "guides/go", ParentSlug: "guides"}
+	article := &model.Article{URI: "/topics/guides/go/testing/articles/mocks", TopicSlug: "guides/go/testing"}
+
+	require.Equal(t, []string{
+		"/topics/guides",
+		"/topics/guides/go",
+		"/topics/guides/go/testing",
+		"/topics/guides/go/testing/articles/mocks",
+	}, dependencies.AffectedPaths([]*model.Topic{topic}, []*model.Article{article}))
+}
@@ -0,0 +1,86 @@
+package invalidating
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FastlyInvalidator purges paths from a Fastly service
+type FastlyInvalidator struct {
+	apiURL     string
+	serviceID  string
+	token      string
+	siteURL    string
+	mode       PurgeMode
+	httpClient *http.Client
+}
+
+// NewFastlyInvalidator creates a new invalidator for the given service. Purging by URL
+// requires the site URL, which every path is appended to
+func NewFastlyInvalidator(apiURL, serviceID, token, siteURL string, mode PurgeMode) *FastlyInvalidator {
+	if apiURL == "" {
+		apiURL = "https://api.fastly.com"
+	}
+	return &FastlyInvalidator{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		serviceID:  serviceID,
+		token:      token,
+		siteURL:    siteURL,
+		mode:       mode,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Invalidate purges the given paths. Surrogate keys are purged in a single request, whereas
+// URLs have to be purged one at a time and the paths which fail are returned as PathErrors
+func (i *FastlyInvalidator) Invalidate(ctx context.Context, paths []string) error {
+	if i.mode == PurgeByKey {
+		slog.Info("purging fastly surrogate keys", "service", i.serviceID, "paths", paths)
+		req, err := i.newRequest(ctx, fmt.Sprintf("%s/service/%s/purge", i.apiURL, i.serviceID))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Surrogate-Key", strings.Join(paths, " "))
+		return do(i.httpClient, req, fmt.Sprintf("%d surrogate keys from fastly", len(paths)))
+	}
+
+	failed := PathErrors{}
+	for n, purgeURL := range joinURLs(i.siteURL, paths) {
+		if err := i.purgeURL(ctx, purgeURL); err != nil {
+			failed[paths[n]] = err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (i *FastlyInvalidator) purgeURL(ctx context.Context, purgeURL string) error {
+	slog.Info("purging fastly url", "url", purgeURL)
+	u, err := url.Parse(purgeURL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse url: %s", purgeURL)
+	}
+	req, err := i.newRequest(ctx, fmt.Sprintf("%s/purge/%s%s", i.apiURL, u.Host, u.RequestURI()))
+	if err != nil {
+		return err
+	}
+	return do(i.httpClient, req, purgeURL+" from fastly")
+}
+
+func (i *FastlyInvalidator) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create fastly purge request")
+	}
+	req.Header.Set("Fastly-Key", i.token)
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
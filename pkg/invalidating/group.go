@@ -0,0 +1,44 @@
+package invalidating
+
+import (
+	"sort"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// Group invalidates paths on several targets, each with its own queue so a failing target
+// does not hold up the others
+type Group []*Queue
+
+// Enqueue queues the given paths to be invalidated on every target
+func (g Group) Enqueue(paths ...string) {
+	for _, queue := range g {
+		queue.Enqueue(paths...)
+	}
+}
+
+// GetDeadLetters returns the paths which could not be invalidated on any target, oldest first
+func (g Group) GetDeadLetters() []*model.FailedInvalidation {
+	deadLetters := []*model.FailedInvalidation{}
+	for _, queue := range g {
+		deadLetters = append(deadLetters, queue.GetDeadLetters()...)
+	}
+	sort.SliceStable(deadLetters, func(i, j int) bool {
+		return deadLetters[i].FailedAt < deadLetters[j].FailedAt
+	})
+	return deadLetters
+}
+
+// RetryDeadLetters queues every dead letter to be invalidated again on its own target
+func (g Group) RetryDeadLetters() {
+	for _, queue := range g {
+		queue.RetryDeadLetters()
+	}
+}
+
+// Shutdown stops every queue
+func (g Group) Shutdown() {
+	for _, queue := range g {
+		queue.Shutdown()
+	}
+}
@@ -0,0 +1,57 @@
+package invalidating
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Invalidator defines somewhere which can have its cached paths invalidated
+type Invalidator interface {
+	Invalidate(ctx context.Context, paths []string) error
+}
+
+// PathErrors is returned by invalidators which know which of the paths failed, holding the
+// error for each of them. Every other path was invalidated
+type PathErrors map[string]error
+
+func (e PathErrors) Error() string {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("failed to invalidate %d paths, first error: %s", len(paths), e[paths[0]])
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// do sends the request, returning an error if it fails or is not successful
+func do(httpClient *http.Client, req *http.Request, description string) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to invalidate %s", description)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("failed to invalidate %s: unexpected status %d", description, resp.StatusCode)
+	}
+	return nil
+}
+
+// joinURLs prefixes every path with the given site URL
+func joinURLs(siteURL string, paths []string) []string {
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = strings.TrimSuffix(siteURL, "/") + path
+	}
+	return urls
+}
@@ -0,0 +1,83 @@
+package invalidating_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/invalidating"
+)
+
+func TestWebhookInvalidatorPostsPaths(t *testing.T) {
+	var payload map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "value", r.Header.Get("X-Custom"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	invalidator := invalidating.NewWebhookInvalidator(server.URL+"/hook", "", map[string]string{"X-Custom": "value"})
+	require.NoError(t, invalidator.Invalidate(context.Background(), []string{"/topics/one"}))
+	require.Equal(t, []string{"/topics/one"}, payload["paths"])
+}
+
+func TestCloudflareInvalidatorPurgesInBatches(t *testing.T) {
+	purged := [][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/zones/zone/purge_cache", r.URL.Path)
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		payload := map[string][]string{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		purged = append(purged, payload["files"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	paths := []string{}
+	for i := 0; i < 31; i++ {
+		paths = append(paths, "/")
+	}
+	invalidator := invalidating.NewCloudflareInvalidator(server.URL, "zone", "token", "https://example.com/", invalidating.PurgeByURL)
+	require.NoError(t, invalidator.Invalidate(context.Background(), paths))
+	require.Len(t, purged, 2)
+	require.Len(t, purged[0], 30)
+	require.Equal(t, "https://example.com/", purged[1][0])
+}
+
+func TestFastlyInvalidator(t *testing.T) {
+	requests := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token", r.Header.Get("Fastly-Key"))
+		requests = append(requests, r)
+		if r.URL.Path == "/purge/example.com/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	invalidator := invalidating.NewFastlyInvalidator(server.URL, "service", "token", "https://example.com", invalidating.PurgeByURL)
+	require.NoError(t, invalidator.Invalidate(context.Background(), []string{"/", "/topics/one"}))
+	require.Len(t, requests, 2)
+	require.Equal(t, "/purge/example.com/topics/one", requests[1].URL.Path)
+
+	requests = nil
+	err := invalidator.Invalidate(context.Background(), []string{"/", "/missing", "/topics/one"})
+	var pathErrors invalidating.PathErrors
+	require.ErrorAs(t, err, &pathErrors)
+	require.Len(t, pathErrors, 1)
+	require.Contains(t, pathErrors, "/missing")
+	require.Len(t, requests, 3)
+
+	requests = nil
+	invalidator = invalidating.NewFastlyInvalidator(server.URL, "service", "token", "", invalidating.PurgeByKey)
+	require.NoError(t, invalidator.Invalidate(context.Background(), []string{"/", "/topics/one"}))
+	require.Len(t, requests, 1)
+	require.Equal(t, "/service/service/purge", requests[0].URL.Path)
+	require.Equal(t, "/ /topics/one", requests[0].Header.Get("Surrogate-Key"))
+}
@@ -0,0 +1,142 @@
+package invalidating
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/signing"
+)
+
+// AuthMode defines how requests to the blog site are authenticated
+type AuthMode string
+
+const (
+	// AuthModeQuery sends the secret in the query string with a request per path. This is
+	// only kept for compatibility as the secret ends up in access logs
+	AuthModeQuery AuthMode = "query"
+	// AuthModeBearer sends the secret as a bearer token with the paths in a JSON body
+	AuthModeBearer AuthMode = "bearer"
+	// AuthModeHMAC signs the JSON body and a timestamp using the secret, so the secret is
+	// never sent
+	AuthModeHMAC AuthMode = "hmac"
+)
+
+const (
+	// TimestampHeader holds the unix time the request was signed at
+	TimestampHeader = "X-Revalidate-Timestamp"
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+	SignatureHeader = "X-Revalidate-Signature"
+)
+
+// ParseAuthMode returns the auth mode with the given name, defaulting to the query mode
+func ParseAuthMode(mode string) (AuthMode, error) {
+	switch AuthMode(mode) {
+	case "", AuthModeQuery:
+		return AuthModeQuery, nil
+	case AuthModeBearer, AuthModeHMAC:
+		return AuthMode(mode), nil
+	}
+	return "", errors.Errorf("unknown invalidation auth mode: %s", mode)
+}
+
+// NextJSInvalidator requests a Next.js site revalidates its cached pages using its
+// /api/revalidate endpoint
+type NextJSInvalidator struct {
+	host       string
+	secret     string
+	authMode   AuthMode
+	httpClient *http.Client
+}
+
+// NextJSOption defines the function used to set Next.js invalidator options
+type NextJSOption func(*NextJSInvalidator)
+
+// WithAuthMode specifies how requests are authenticated
+func WithAuthMode(authMode AuthMode) NextJSOption {
+	return func(c *NextJSInvalidator) {
+		c.authMode = authMode
+	}
+}
+
+// NewNextJSInvalidator creates a new invalidator for the Next.js site at the given host
+func NewNextJSInvalidator(host, secret string, opts ...NextJSOption) *NextJSInvalidator {
+	c := &NextJSInvalidator{
+		host:       host,
+		secret:     secret,
+		authMode:   AuthModeQuery,
+		httpClient: newHTTPClient(),
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Invalidate requests the site revalidates each of the given paths. In query mode every path
+// is requested separately, and the paths which fail are returned as PathErrors
+func (c *NextJSInvalidator) Invalidate(ctx context.Context, paths []string) error {
+	if c.authMode != AuthModeQuery {
+		return c.invalidatePaths(ctx, paths)
+	}
+
+	failed := PathErrors{}
+	for _, path := range paths {
+		if err := c.invalidatePath(ctx, path); err != nil {
+			failed[path] = err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (c *NextJSInvalidator) invalidatePath(ctx context.Context, path string) error {
+	slog.Info("invalidating site cache", "path", path)
+	query := url.Values{"path": {path}, "secret": {c.secret}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/revalidate?%s", c.host, query.Encode()), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create invalidation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return do(c.httpClient, req, path)
+}
+
+// invalidatePaths sends every path in a single authenticated request
+func (c *NextJSInvalidator) invalidatePaths(ctx context.Context, paths []string) error {
+	slog.Info("invalidating site cache", "paths", paths)
+	body, err := json.Marshal(map[string][]string{"paths": paths})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode invalidation request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/revalidate", c.host), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create invalidation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	switch c.authMode {
+	case AuthModeBearer:
+		req.Header.Set("Authorization", "Bearer "+c.secret)
+	case AuthModeHMAC:
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, signing.Sign(c.secret, timestamp, body))
+	}
+
+	return do(c.httpClient, req, fmt.Sprintf("%d paths", len(paths)))
+}
@@ -0,0 +1,54 @@
+package invalidating_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/invalidating"
+	"github.com/wamphlett/blog-server/pkg/signing"
+)
+
+func TestNextJSInvalidatorSignsRequestsInHMACMode(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header
+		require.Empty(t, r.URL.RawQuery)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := invalidating.NewNextJSInvalidator(server.URL, "secret", invalidating.WithAuthMode(invalidating.AuthModeHMAC))
+	require.NoError(t, client.Invalidate(context.Background(), []string{"/", "/topics/one"}))
+
+	payload := map[string][]string{}
+	require.NoError(t, json.Unmarshal(body, &payload))
+	require.Equal(t, []string{"/", "/topics/one"}, payload["paths"])
+	require.Empty(t, headers.Get("Authorization"))
+	timestamp := headers.Get(invalidating.TimestampHeader)
+	require.NotEmpty(t, timestamp)
+	require.Equal(t, signing.Sign("secret", timestamp, body), headers.Get(invalidating.SignatureHeader))
+}
+
+func TestNextJSInvalidatorSendsBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := invalidating.NewNextJSInvalidator(server.URL, "secret", invalidating.WithAuthMode(invalidating.AuthModeBearer))
+	require.NoError(t, client.Invalidate(context.Background(), []string{"/"}))
+
+	client = invalidating.NewNextJSInvalidator(server.URL, "wrong", invalidating.WithAuthMode(invalidating.AuthModeBearer))
+	require.Error(t, client.Invalidate(context.Background(), []string{"/"}))
+}
@@ -0,0 +1,303 @@
+package invalidating
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// Metrics defines the metrics used by the queue
+type Metrics interface {
+	Invalidated(target string, startTime time.Time, paths int, success bool)
+	InvalidationDeadLettered(target string, paths int)
+}
+
+type item struct {
+	path     string
+	attempts int
+}
+
+// Queue invalidates paths in the background, batching them together and retrying failed
+// requests with an exponential backoff. Paths which still fail are moved to a dead letter list
+type Queue struct {
+	name        string
+	invalidator Invalidator
+	metrics     Metrics
+
+	items chan *item
+	// pending holds every path which is queued or being retried so it is only queued once
+	pending     map[string]bool
+	deadLetters []*model.FailedInvalidation
+	lock        sync.Mutex
+
+	queueSize      int
+	batchSize      int
+	batchWindow    time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxDeadLetters int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Option defines the function used to set options
+type Option func(*Queue)
+
+// WithName specifies the name of the target, which is used in logs, metrics and dead letters
+func WithName(name string) Option {
+	return func(q *Queue) {
+		q.name = name
+	}
+}
+
+// WithQueueSize specifies how many paths can be waiting to be invalidated
+func WithQueueSize(queueSize int) Option {
+	return func(q *Queue) {
+		q.queueSize = queueSize
+	}
+}
+
+// WithBatchSize specifies the most paths to invalidate at once, along with how long to wait
+// for further paths before invalidating a partial batch
+func WithBatchSize(batchSize int, batchWindow time.Duration) Option {
+	return func(q *Queue) {
+		q.batchSize = batchSize
+		q.batchWindow = batchWindow
+	}
+}
+
+// WithRetries specifies how many times a path is attempted before it is dead lettered, along
+// with the backoff between attempts which doubles after every failure
+func WithRetries(maxAttempts int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(q *Queue) {
+		q.maxAttempts = maxAttempts
+		q.initialBackoff = initialBackoff
+		q.maxBackoff = maxBackoff
+	}
+}
+
+// WithMaxDeadLetters specifies how many dead letters are kept
+func WithMaxDeadLetters(maxDeadLetters int) Option {
+	return func(q *Queue) {
+		q.maxDeadLetters = maxDeadLetters
+	}
+}
+
+// New creates a new queue which invalidates paths using the given invalidator
+func New(invalidator Invalidator, metrics Metrics, opts ...Option) *Queue {
+	q := &Queue{
+		name:           "default",
+		invalidator:    invalidator,
+		metrics:        metrics,
+		pending:        map[string]bool{},
+		deadLetters:    []*model.FailedInvalidation{},
+		queueSize:      1000,
+		batchSize:      20,
+		batchWindow:    time.Second,
+		maxAttempts:    5,
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+		maxDeadLetters: 100,
+		done:           make(chan struct{}),
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	q.items = make(chan *item, q.queueSize)
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	go q.run()
+
+	return q
+}
+
+// Enqueue queues the given paths to be invalidated. Paths which are already queued are ignored
+func (q *Queue) Enqueue(paths ...string) {
+	for _, path := range paths {
+		q.lock.Lock()
+		if q.pending[path] {
+			q.lock.Unlock()
+			continue
+		}
+		q.pending[path] = true
+		q.lock.Unlock()
+
+		q.push(&item{path: path})
+	}
+}
+
+// GetDeadLetters returns the paths which could not be invalidated, oldest first
+func (q *Queue) GetDeadLetters() []*model.FailedInvalidation {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	deadLetters := make([]*model.FailedInvalidation, len(q.deadLetters))
+	copy(deadLetters, q.deadLetters)
+	return deadLetters
+}
+
+// RetryDeadLetters clears the dead letter list and queues every path in it again
+func (q *Queue) RetryDeadLetters() {
+	q.lock.Lock()
+	deadLetters := q.deadLetters
+	q.deadLetters = []*model.FailedInvalidation{}
+	q.lock.Unlock()
+
+	for _, deadLetter := range deadLetters {
+		q.Enqueue(deadLetter.Path)
+	}
+}
+
+// Shutdown stops the queue once the batch currently being sent has finished. Anything still
+// queued is abandoned
+func (q *Queue) Shutdown() {
+	slog.Info("invalidation queue shutting down", "target", q.name)
+	q.cancel()
+	<-q.done
+}
+
+// push adds the item to the queue without blocking. If the queue is full, the item is dead lettered
+func (q *Queue) push(i *item) {
+	select {
+	case q.items <- i:
+	default:
+		q.deadLetter([]*item{i}, errors.New("invalidation queue is full"))
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case first := <-q.items:
+			q.send(q.collectBatch(first))
+		}
+	}
+}
+
+// collectBatch waits for further items to send along with the given item until either the
+// batch is full or the batch window has passed
+func (q *Queue) collectBatch(first *item) []*item {
+	batch := []*item{first}
+	timeout := time.After(q.batchWindow)
+	for len(batch) < q.batchSize {
+		select {
+		case i := <-q.items:
+			batch = append(batch, i)
+		case <-timeout:
+			return batch
+		case <-q.ctx.Done():
+			return batch
+		}
+	}
+	return batch
+}
+
+func (q *Queue) send(batch []*item) {
+	paths := make([]string, len(batch))
+	for i, item := range batch {
+		paths[i] = item.path
+		item.attempts++
+	}
+
+	startTime := time.Now()
+	err := q.invalidator.Invalidate(q.ctx, paths)
+	q.metrics.Invalidated(q.name, startTime, len(paths), err == nil)
+
+	if err == nil {
+		q.lock.Lock()
+		for _, path := range paths {
+			delete(q.pending, path)
+		}
+		q.lock.Unlock()
+		return
+	}
+
+	// only the paths which failed are retried when the invalidator reports them, otherwise the
+	// whole batch is retried
+	failed := batch
+	var pathErrors PathErrors
+	if errors.As(err, &pathErrors) {
+		failed = []*item{}
+		q.lock.Lock()
+		for _, item := range batch {
+			if _, ok := pathErrors[item.path]; ok {
+				failed = append(failed, item)
+				continue
+			}
+			delete(q.pending, item.path)
+		}
+		q.lock.Unlock()
+		if len(failed) == 0 {
+			return
+		}
+	}
+
+	slog.Warn("failed to invalidate paths", "target", q.name, "paths", len(failed), "attempt", failed[0].attempts, "error", err)
+
+	retries := []*item{}
+	exhausted := []*item{}
+	for _, item := range failed {
+		if item.attempts >= q.maxAttempts {
+			exhausted = append(exhausted, item)
+			continue
+		}
+		retries = append(retries, item)
+	}
+
+	if len(exhausted) > 0 {
+		q.deadLetter(exhausted, err)
+	}
+	if len(retries) > 0 {
+		time.AfterFunc(q.backoff(retries[0].attempts), func() {
+			for _, item := range retries {
+				q.push(item)
+			}
+		})
+	}
+}
+
+// backoff returns how long to wait before the next attempt
+func (q *Queue) backoff(attempts int) time.Duration {
+	backoff := q.initialBackoff
+	for i := 1; i < attempts && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, q.maxBackoff)
+}
+
+func (q *Queue) deadLetter(items []*item, err error) {
+	slog.Error("giving up invalidating paths", "target", q.name, "paths", len(items), "error", err)
+	sentry.CaptureException(errors.Wrapf(err, "failed to invalidate %d paths on %s", len(items), q.name))
+	q.metrics.InvalidationDeadLettered(q.name, len(items))
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, item := range items {
+		delete(q.pending, item.path)
+		q.deadLetters = append(q.deadLetters, &model.FailedInvalidation{
+			Target:   q.name,
+			Path:     item.path,
+			Attempts: item.attempts,
+			Error:    err.Error(),
+			FailedAt: time.Now().Unix(),
+		})
+	}
+	if len(q.deadLetters) > q.maxDeadLetters {
+		q.deadLetters = q.deadLetters[len(q.deadLetters)-q.maxDeadLetters:]
+	}
+}
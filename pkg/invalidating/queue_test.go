@@ -0,0 +1,106 @@
+package invalidating_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/invalidating"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) Invalidated(target string, startTime time.Time, paths int, success bool) {}
+func (noopMetrics) InvalidationDeadLettered(target string, paths int)                       {}
+
+func TestQueueRetriesFailedInvalidations(t *testing.T) {
+	lock := sync.Mutex{}
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		path := r.URL.Query().Get("path")
+		requests[path]++
+		// fail the first attempt for every path
+		if requests[path] == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	queue := invalidating.New(invalidating.NewNextJSInvalidator(server.URL, "secret"), noopMetrics{},
+		invalidating.WithBatchSize(10, 10*time.Millisecond),
+		invalidating.WithRetries(3, 10*time.Millisecond, 50*time.Millisecond),
+	)
+	defer queue.Shutdown()
+
+	queue.Enqueue("/topics/one", "/topics/one")
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests["/topics/one"] == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, queue.GetDeadLetters())
+}
+
+func TestQueueDeadLettersExhaustedInvalidations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	queue := invalidating.New(invalidating.NewNextJSInvalidator(server.URL, "secret"), noopMetrics{},
+		invalidating.WithBatchSize(10, 10*time.Millisecond),
+		invalidating.WithRetries(2, 10*time.Millisecond, 10*time.Millisecond),
+	)
+	defer queue.Shutdown()
+
+	queue.Enqueue("/")
+
+	require.Eventually(t, func() bool {
+		return len(queue.GetDeadLetters()) == 1
+	}, time.Second, 10*time.Millisecond)
+	deadLetter := queue.GetDeadLetters()[0]
+	require.Equal(t, "/", deadLetter.Path)
+	require.Equal(t, 2, deadLetter.Attempts)
+}
+
+func TestQueueOnlyRetriesPathsWhichFailed(t *testing.T) {
+	lock := sync.Mutex{}
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		path := r.URL.Query().Get("path")
+		requests[path]++
+		if path == "/broken" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	queue := invalidating.New(invalidating.NewNextJSInvalidator(server.URL, "secret"), noopMetrics{},
+		invalidating.WithBatchSize(10, 10*time.Millisecond),
+		invalidating.WithRetries(3, 10*time.Millisecond, 10*time.Millisecond),
+	)
+	defer queue.Shutdown()
+
+	queue.Enqueue("/", "/broken")
+
+	require.Eventually(t, func() bool {
+		return len(queue.GetDeadLetters()) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "/broken", queue.GetDeadLetters()[0].Path)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, map[string]int{"/": 1, "/broken": 3}, requests)
+}
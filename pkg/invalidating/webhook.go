@@ -0,0 +1,60 @@
+package invalidating
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/signing"
+)
+
+// WebhookInvalidator posts the paths to invalidate to a URL as JSON
+type WebhookInvalidator struct {
+	url        string
+	secret     string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+// NewWebhookInvalidator creates a new invalidator which posts to the given URL. If a secret is
+// given, requests are signed in the same way as the Next.js invalidator's hmac mode. The given
+// headers are added to every request
+func NewWebhookInvalidator(url, secret string, headers map[string]string) *WebhookInvalidator {
+	return &WebhookInvalidator{
+		url:        url,
+		secret:     secret,
+		headers:    headers,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Invalidate posts a {"paths": [...]} body to the webhook URL
+func (i *WebhookInvalidator) Invalidate(ctx context.Context, paths []string) error {
+	slog.Info("sending invalidation webhook", "url", i.url, "paths", paths)
+	body, err := json.Marshal(map[string][]string{"paths": paths})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode invalidation webhook")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create invalidation webhook")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range i.headers {
+		req.Header.Set(name, value)
+	}
+	if i.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, signing.Sign(i.secret, timestamp, body))
+	}
+
+	return do(i.httpClient, req, "paths with webhook")
+}
@@ -1,33 +1,112 @@
 package memorydatabase
 
 import (
+	"sync"
+
+	"github.com/pkg/errors"
+
 	"github.com/wamphlett/blog-server/pkg/model"
 )
 
 type Database struct {
-	topics   map[string]*model.Topic
-	articles map[string]map[string]*model.Article
+	topics        map[string]*model.Topic
+	articles      map[string]map[string]*model.Article
+	updaterStates map[string]*model.UpdaterState
+	lock          sync.RWMutex
 }
 
 func New() *Database {
 	return &Database{
-		topics:   map[string]*model.Topic{},
-		articles: map[string]map[string]*model.Article{},
+		topics:        map[string]*model.Topic{},
+		articles:      map[string]map[string]*model.Article{},
+		updaterStates: map[string]*model.UpdaterState{},
 	}
 }
 
-func (d *Database) StoreTopic(topic *model.Topic) {
-	d.topics[topic.Slug] = topic
+// StoreTopic stores the given topic. An error is returned if a different source has already
+// provided a topic with the same slug
+func (d *Database) StoreTopic(topic *model.Topic) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.storeTopic(topic)
 }
 
-func (d *Database) StoreArticle(article *model.Article) {
-	if _, ok := d.articles[article.TopicSlug]; !ok {
-		d.articles[article.TopicSlug] = map[string]*model.Article{}
+// StoreArticle stores the given article. An error is returned if the article's topic has been
+// provided by a different source
+func (d *Database) StoreArticle(article *model.Article) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.storeArticle(article)
+}
+
+// DeleteTopic deletes the topic with the given slug along with all of its articles
+func (d *Database) DeleteTopic(slug string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.topics, slug)
+	delete(d.articles, slug)
+	return nil
+}
+
+// DeleteArticle deletes the article with the given slug
+func (d *Database) DeleteArticle(topicSlug, slug string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deleteArticle(topicSlug, slug)
+	return nil
+}
+
+// ApplyChanges applies every change at once, so that nothing reading the database sees only
+// part of them. Changes which conflict with another source are skipped and returned as errors,
+// and the changes which were applied are returned
+func (d *Database) ApplyChanges(changes *model.ContentChanges) (*model.ContentChanges, []error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	applied := &model.ContentChanges{}
+	problems := []error{}
+
+	// deletions come first so that content can move between slugs within a single update
+	for _, topic := range changes.DeletedTopics {
+		if existing, ok := d.topics[topic.Slug]; ok && existing.Source != topic.Source {
+			problems = append(problems, errors.Errorf("cannot delete topic %q from source %q as it belongs to source %q", topic.Slug, topic.Source, existing.Source))
+			continue
+		}
+		delete(d.topics, topic.Slug)
+		delete(d.articles, topic.Slug)
+		applied.DeletedTopics = append(applied.DeletedTopics, topic)
 	}
-	d.articles[article.TopicSlug][article.Slug] = article
+	for _, article := range changes.DeletedArticles {
+		if existing, ok := d.articles[article.TopicSlug][article.Slug]; ok && existing.Source != article.Source {
+			problems = append(problems, errors.Errorf("cannot delete article %q from source %q as it belongs to source %q", article.Slug, article.Source, existing.Source))
+			continue
+		}
+		d.deleteArticle(article.TopicSlug, article.Slug)
+		applied.DeletedArticles = append(applied.DeletedArticles, article)
+	}
+
+	for _, topic := range changes.Topics {
+		if err := d.storeTopic(topic); err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		applied.Topics = append(applied.Topics, topic)
+	}
+	for _, article := range changes.Articles {
+		if err := d.storeArticle(article); err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		applied.Articles = append(applied.Articles, article)
+	}
+
+	return applied, problems
 }
 
 func (d *Database) GetAllTopics() []*model.Topic {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
 	topics := make([]*model.Topic, 0, len(d.topics))
 	for _, topic := range d.topics {
 		topics = append(topics, topic)
@@ -36,6 +115,9 @@ func (d *Database) GetAllTopics() []*model.Topic {
 }
 
 func (d *Database) GetAllArticles() []*model.Article {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
 	articles := []*model.Article{}
 	for _, topicArticles := range d.articles {
 		for _, article := range topicArticles {
@@ -46,6 +128,9 @@ func (d *Database) GetAllArticles() []*model.Article {
 }
 
 func (d *Database) GetAllArticlesForTopic(topicSlug string) []*model.Article {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
 	if _, ok := d.articles[topicSlug]; !ok {
 		return []*model.Article{}
 	}
@@ -56,3 +141,50 @@ func (d *Database) GetAllArticlesForTopic(topicSlug string) []*model.Article {
 	}
 	return articles
 }
+
+// GetUpdaterState returns the state stored by the updater of the given source, or nil if there
+// is none
+func (d *Database) GetUpdaterState(source string) (*model.UpdaterState, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.updaterStates[source], nil
+}
+
+// StoreUpdaterState stores the state of the updater of the given source
+func (d *Database) StoreUpdaterState(source string, state *model.UpdaterState) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.updaterStates[source] = state
+	return nil
+}
+
+// Close does nothing as nothing is kept beyond the life of the process
+func (d *Database) Close() error {
+	return nil
+}
+
+func (d *Database) storeTopic(topic *model.Topic) error {
+	if existing, ok := d.topics[topic.Slug]; ok && existing.Source != topic.Source {
+		return errors.Errorf("topic %q from source %q conflicts with the topic from source %q", topic.Slug, topic.Source, existing.Source)
+	}
+	d.topics[topic.Slug] = topic
+	return nil
+}
+
+func (d *Database) storeArticle(article *model.Article) error {
+	if topic, ok := d.topics[article.TopicSlug]; ok && topic.Source != article.Source {
+		return errors.Errorf("article %q from source %q conflicts with the topic from source %q", article.Slug, article.Source, topic.Source)
+	}
+	if _, ok := d.articles[article.TopicSlug]; !ok {
+		d.articles[article.TopicSlug] = map[string]*model.Article{}
+	}
+	d.articles[article.TopicSlug][article.Slug] = article
+	return nil
+}
+
+func (d *Database) deleteArticle(topicSlug, slug string) {
+	delete(d.articles[topicSlug], slug)
+	if len(d.articles[topicSlug]) == 0 {
+		delete(d.articles, topicSlug)
+	}
+}
@@ -0,0 +1,97 @@
+package memorydatabase_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	memorydatabase "github.com/wamphlett/blog-server/pkg/memoryDatabase"
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+func TestAppliesChangesSkippingConflicts(t *testing.T) {
+	db := memorydatabase.New()
+	require.NoError(t, db.StoreTopic(&model.Topic{Slug: "go", Source: "main"}))
+	require.NoError(t, db.StoreArticle(&model.Article{Slug: "channels", TopicSlug: "go", Source: "main"}))
+	require.NoError(t, db.StoreTopic(&model.Topic{Slug: "rust", Source: "other"}))
+
+	applied, problems := db.ApplyChanges(&model.ContentChanges{
+		Topics:          []*model.Topic{{Slug: "python", Source: "main"}, {Slug: "rust", Source: "main"}},
+		Articles:        []*model.Article{{Slug: "generators", TopicSlug: "python", Source: "main"}},
+		DeletedArticles: []*model.Article{{Slug: "channels", TopicSlug: "go", Source: "main"}},
+	})
+	require.Len(t, problems, 1)
+	require.Len(t, applied.Topics, 1)
+	require.Len(t, applied.Articles, 1)
+	require.Len(t, applied.DeletedArticles, 1)
+	require.Empty(t, db.GetAllArticlesForTopic("go"))
+	require.Len(t, db.GetAllTopics(), 3)
+
+	require.NoError(t, db.DeleteTopic("python"))
+	require.Len(t, db.GetAllTopics(), 2)
+	require.Empty(t, db.GetAllArticles())
+}
+
+func TestIsSafeForConcurrentUse(t *testing.T) {
+	db := memorydatabase.New()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			db.ApplyChanges(&model.ContentChanges{
+				Topics:   []*model.Topic{{Slug: "go"}},
+				Articles: []*model.Article{{Slug: fmt.Sprint(i), TopicSlug: "go"}},
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			db.GetAllTopics()
+			db.GetAllArticles()
+		}()
+	}
+	wg.Wait()
+	require.Len(t, db.GetAllArticles(), 10)
+}
+
+func TestRejectsContentFromConflictingSources(t *testing.T) {
+	db := memorydatabase.New()
+	require.NoError(t, db.StoreTopic(&model.Topic{Slug: "go", Source: "main", Title: "Go"}))
+	require.NoError(t, db.StoreArticle(&model.Article{Slug: "channels", TopicSlug: "go", Source: "main"}))
+
+	// the source which provided a topic can replace it and add articles to it
+	require.NoError(t, db.StoreTopic(&model.Topic{Slug: "go", Source: "main", Title: "Golang"}))
+	require.NoError(t, db.StoreArticle(&model.Article{Slug: "generics", TopicSlug: "go", Source: "main"}))
+
+	// other sources can do neither
+	require.EqualError(t, db.StoreTopic(&model.Topic{Slug: "go", Source: "other"}),
+		`topic "go" from source "other" conflicts with the topic from source "main"`)
+	require.EqualError(t, db.StoreArticle(&model.Article{Slug: "maps", TopicSlug: "go", Source: "other"}),
+		`article "maps" from source "other" conflicts with the topic from source "main"`)
+
+	applied, problems := db.ApplyChanges(&model.ContentChanges{
+		DeletedTopics:   []*model.Topic{{Slug: "go", Source: "other"}},
+		DeletedArticles: []*model.Article{{Slug: "channels", TopicSlug: "go", Source: "other"}},
+	})
+	require.Len(t, problems, 2)
+	require.EqualError(t, problems[0], `cannot delete topic "go" from source "other" as it belongs to source "main"`)
+	require.EqualError(t, problems[1], `cannot delete article "channels" from source "other" as it belongs to source "main"`)
+	require.Empty(t, applied.DeletedTopics)
+	require.Empty(t, applied.DeletedArticles)
+
+	topics := db.GetAllTopics()
+	require.Len(t, topics, 1)
+	require.Equal(t, "Golang", topics[0].Title)
+	require.Len(t, db.GetAllArticlesForTopic("go"), 2)
+
+	// deleting the topic from its own source frees the slug for another source
+	_, problems = db.ApplyChanges(&model.ContentChanges{
+		DeletedTopics: []*model.Topic{{Slug: "go", Source: "main"}},
+		Topics:        []*model.Topic{{Slug: "go", Source: "other"}},
+	})
+	require.Empty(t, problems)
+	require.Equal(t, "other", db.GetAllTopics()[0].Source)
+	require.Empty(t, db.GetAllArticlesForTopic("go"))
+}
@@ -1,37 +1,29 @@
 package metrics
 
 import (
-	"context"
-	"time"
-
-	"log/slog"
-
-	"github.com/getsentry/sentry-go"
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
-	"github.com/influxdata/influxdb-client-go/v2/api/write"
-	"github.com/pkg/errors"
-
-	"github.com/wamphlett/blog-server/config"
+	"net/http"
 )
 
+// Backend defines where metrics are recorded. Every metric is a measurement with a set of
+// fields and tags, which each backend maps to its own data model
+type Backend interface {
+	Publish(measurement string, fields map[string]interface{}, tags map[string]string)
+	Close()
+}
+
 // Client defines a new metrics client
 type Client struct {
-	influx      influxdb2.Client
-	writer      api.WriteAPIBlocking
+	backend     Backend
 	defaultTags map[string]string
 }
 
 // Options defines the function required for settings options
 type Option func(*Client)
 
-// New creates a new metrics client with the given options
-func New(cfg *config.InfluxConfig, options ...Option) *Client {
-	slog.Info("initialising new influxdb client")
-	client := influxdb2.NewClient(cfg.Host, cfg.Token)
+// New creates a new metrics client which records metrics using the given backend
+func New(backend Backend, options ...Option) *Client {
 	c := &Client{
-		influx:      client,
-		writer:      client.WriteAPIBlocking(cfg.Org, cfg.Bucket),
+		backend:     backend,
 		defaultTags: map[string]string{},
 	}
 
@@ -52,19 +44,38 @@ func WithDefaultTags(tags map[string]string) Option {
 	}
 }
 
-func (c *Client) publish(measurement string, fields map[string]interface{}, tags map[string]string) {
-	p := influxdb2.NewPoint(measurement, mergeTags(tags, c.defaultTags), fields, time.Now())
-	if err := c.writer.WritePoint(context.Background(), p); err != nil {
-		slog.Error("failed to publish metric", "measurement", measurement, "error", err)
-		sentry.CaptureException(errors.Wrap(err, "failed to publish metrics to influxdb"))
+// WithTags returns a client which shares the same backend but adds the given tags to every metric
+func (c *Client) WithTags(tags map[string]string) *Client {
+	defaultTags := map[string]string{}
+	for tag, value := range c.defaultTags {
+		defaultTags[tag] = value
+	}
+	for tag, value := range tags {
+		defaultTags[tag] = value
+	}
+
+	return &Client{
+		backend:     c.backend,
+		defaultTags: defaultTags,
 	}
 }
 
-func (c *Client) publishBatch(points []*write.Point) {
-	if err := c.writer.WritePoint(context.Background(), points...); err != nil {
-		slog.Error("failed to publish batch metrics", "count", len(points), "error", err)
-		sentry.CaptureException(errors.Wrap(err, "failed to publish batch metrics to influxdb"))
+// Handler returns the handler which exposes the metrics to be scraped, or nil if the backend
+// pushes its metrics elsewhere
+func (c *Client) Handler() http.Handler {
+	if scraped, ok := c.backend.(interface{ Handler() http.Handler }); ok {
+		return scraped.Handler()
 	}
+	return nil
+}
+
+// Close flushes any pending metrics and closes the backend
+func (c *Client) Close() {
+	c.backend.Close()
+}
+
+func (c *Client) publish(measurement string, fields map[string]interface{}, tags map[string]string) {
+	c.backend.Publish(measurement, fields, mergeTags(tags, c.defaultTags))
 }
 
 func mergeTags(base, tags map[string]string) map[string]string {
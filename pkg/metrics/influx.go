@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/config"
+)
+
+// InfluxBackend writes metrics to InfluxDB in the background. Points are queued and written in
+// batches, so an outage never slows down whatever is being measured. If the queue is full,
+// points are dropped and counted
+type InfluxBackend struct {
+	influx influxdb2.Client
+	writer api.WriteAPIBlocking
+
+	points  chan *write.Point
+	dropped atomic.Int64
+
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+
+	done      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// InfluxOption defines the function used to set InfluxDB options
+type InfluxOption func(*InfluxBackend)
+
+// WithQueueSize specifies how many points can be waiting to be written
+func WithQueueSize(queueSize int) InfluxOption {
+	return func(b *InfluxBackend) {
+		b.queueSize = queueSize
+	}
+}
+
+// WithBatching specifies the most points written at once, along with how often points are
+// written when the batch is not full
+func WithBatching(batchSize int, flushInterval time.Duration) InfluxOption {
+	return func(b *InfluxBackend) {
+		b.batchSize = batchSize
+		b.flushInterval = flushInterval
+	}
+}
+
+// NewInfluxBackend creates a new backend which writes to the configured InfluxDB bucket
+func NewInfluxBackend(cfg *config.InfluxConfig, opts ...InfluxOption) *InfluxBackend {
+	slog.Info("initialising new influxdb client")
+	client := influxdb2.NewClient(cfg.Host, cfg.Token)
+	b := &InfluxBackend{
+		influx:        client,
+		writer:        client.WriteAPIBlocking(cfg.Org, cfg.Bucket),
+		queueSize:     10000,
+		batchSize:     500,
+		flushInterval: 10 * time.Second,
+		done:          make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	b.points = make(chan *write.Point, b.queueSize)
+	go b.run()
+
+	return b
+}
+
+// Publish queues the measurement to be written without blocking
+func (b *InfluxBackend) Publish(measurement string, fields map[string]interface{}, tags map[string]string) {
+	select {
+	case b.points <- influxdb2.NewPoint(measurement, tags, fields, time.Now()):
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+// Close writes every queued point and closes the InfluxDB client
+func (b *InfluxBackend) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		<-b.closed
+		b.influx.Close()
+	})
+}
+
+// run writes the queued points whenever a batch is full or the flush interval passes
+func (b *InfluxBackend) run() {
+	defer close(b.closed)
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*write.Point, 0, b.batchSize)
+	flush := func() {
+		if dropped := b.dropped.Swap(0); dropped > 0 {
+			slog.Warn("dropped metrics as the queue was full", "count", dropped)
+			batch = append(batch, influxdb2.NewPoint("metrics_dropped", noTags(), map[string]interface{}{
+				"count": dropped,
+			}, time.Now()))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		b.publishBatch(batch)
+		batch = make([]*write.Point, 0, b.batchSize)
+	}
+
+	for {
+		select {
+		case p := <-b.points:
+			batch = append(batch, p)
+			if len(batch) >= b.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.done:
+			// write whatever is left before closing
+			for {
+				select {
+				case p := <-b.points:
+					batch = append(batch, p)
+					if len(batch) >= b.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *InfluxBackend) publishBatch(points []*write.Point) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := b.writer.WritePoint(ctx, points...); err != nil {
+		slog.Error("failed to publish batch metrics", "count", len(points), "error", err)
+		sentry.CaptureException(errors.Wrap(err, "failed to publish batch metrics to influxdb"))
+	}
+}
@@ -0,0 +1,57 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/config"
+	"github.com/wamphlett/blog-server/pkg/metrics"
+)
+
+func TestInfluxBackendWritesBatchesInTheBackground(t *testing.T) {
+	lock := sync.Mutex{}
+	writes := []string{}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		writes = append(writes, string(body))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	backend := metrics.NewInfluxBackend(&config.InfluxConfig{Host: server.URL, Org: "org", Bucket: "bucket"},
+		metrics.WithQueueSize(2),
+		metrics.WithBatching(2, time.Hour),
+	)
+	client := metrics.New(backend)
+
+	// publishing never blocks, even while influx is not responding
+	startTime := time.Now()
+	for i := 0; i < 10; i++ {
+		client.ParseFile(time.Now())
+	}
+	require.Less(t, time.Since(startTime), 100*time.Millisecond)
+
+	close(release)
+	client.Close()
+
+	lock.Lock()
+	defer lock.Unlock()
+	points := 0
+	dropped := false
+	for _, write := range writes {
+		points += strings.Count(write, "parse_file")
+		dropped = dropped || strings.Contains(write, "metrics_dropped")
+	}
+	require.Less(t, points, 10)
+	require.True(t, dropped)
+}
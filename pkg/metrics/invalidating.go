@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Invalidated records every time a batch of paths was sent to be invalidated
+func (c *Client) Invalidated(target string, startTime time.Time, paths int, success bool) {
+	fields := map[string]interface{}{
+		"time_taken_ms": time.Since(startTime).Milliseconds(),
+		"count":         1,
+		"path_count":    paths,
+	}
+	tags := map[string]string{
+		"target":  target,
+		"success": strconv.FormatBool(success),
+	}
+	c.publish("invalidated", fields, tags)
+}
+
+// InvalidationDeadLettered records every time paths were given up on after failing to be invalidated
+func (c *Client) InvalidationDeadLettered(target string, paths int) {
+	fields := map[string]interface{}{
+		"count":      1,
+		"path_count": paths,
+	}
+	c.publish("invalidation_dead_lettered", fields, map[string]string{"target": target})
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// EventDelivered records every attempt to deliver an event to a webhook
+func (c *Client) EventDelivered(webhook, eventType string, startTime time.Time, success bool) {
+	fields := map[string]interface{}{
+		"time_taken_ms": time.Since(startTime).Milliseconds(),
+		"count":         1,
+	}
+	tags := map[string]string{
+		"webhook": webhook,
+		"event":   eventType,
+		"success": strconv.FormatBool(success),
+	}
+	c.publish("event_delivered", fields, tags)
+}
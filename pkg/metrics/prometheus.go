@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// sizeBuckets are the buckets of histograms which observe sizes in bytes, from 256B to 4MB
+var sizeBuckets = prometheus.ExponentialBuckets(256, 4, 8)
+
+// PrometheusBackend exposes metrics to be scraped by Prometheus. Every measurement is counted,
+// its time_taken_ms field is observed by a latency histogram, fields ending in _bytes are
+// observed by a size histogram and any other numeric fields are set as gauges. Tags and string
+// fields become labels
+type PrometheusBackend struct {
+	namespace string
+	registry  *prometheus.Registry
+
+	counters   map[string]*labelledVec[*prometheus.CounterVec]
+	histograms map[string]*labelledVec[*prometheus.HistogramVec]
+	gauges     map[string]*labelledVec[*prometheus.GaugeVec]
+	lock       sync.Mutex
+}
+
+// labelledVec holds a metric vector along with its label names, which are fixed once created
+type labelledVec[T any] struct {
+	vec    T
+	labels []string
+}
+
+// NewPrometheusBackend creates a new backend with every metric name prefixed by the namespace
+func NewPrometheusBackend(namespace string) *PrometheusBackend {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	return &PrometheusBackend{
+		namespace:  namespace,
+		registry:   registry,
+		counters:   map[string]*labelledVec[*prometheus.CounterVec]{},
+		histograms: map[string]*labelledVec[*prometheus.HistogramVec]{},
+		gauges:     map[string]*labelledVec[*prometheus.GaugeVec]{},
+	}
+}
+
+// Handler returns the handler which serves the metrics in the Prometheus exposition format
+func (b *PrometheusBackend) Handler() http.Handler {
+	return promhttp.HandlerFor(b.registry, promhttp.HandlerOpts{})
+}
+
+// Publish records the measurement
+func (b *PrometheusBackend) Publish(measurement string, fields map[string]interface{}, tags map[string]string) {
+	labels := map[string]string{}
+	for tag, value := range tags {
+		labels[tag] = value
+	}
+	numbers := map[string]float64{}
+	for field, value := range fields {
+		switch v := value.(type) {
+		case string:
+			labels[field] = v
+		case int:
+			numbers[field] = float64(v)
+		case int64:
+			numbers[field] = float64(v)
+		case float64:
+			numbers[field] = v
+		case bool:
+			labels[field] = "false"
+			if v {
+				labels[field] = "true"
+			}
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	count, ok := numbers["count"]
+	if !ok {
+		count = 1
+	}
+	counter := b.counter(measurement, labels)
+	counter.vec.WithLabelValues(labelValues(counter.labels, labels)...).Add(count)
+
+	for field, value := range numbers {
+		switch field {
+		case "count":
+		case "time_taken_ms":
+			histogram := b.histogram(measurement+"_duration_seconds", "How long "+measurement+" took.", prometheus.DefBuckets, labels)
+			histogram.vec.WithLabelValues(labelValues(histogram.labels, labels)...).Observe(value / 1000)
+		default:
+			if strings.HasSuffix(field, "_bytes") {
+				histogram := b.histogram(measurement+"_"+field, "The size of "+measurement+" "+field+".", sizeBuckets, labels)
+				histogram.vec.WithLabelValues(labelValues(histogram.labels, labels)...).Observe(value)
+				continue
+			}
+			gauge := b.gauge(measurement+"_"+field, labels)
+			gauge.vec.WithLabelValues(labelValues(gauge.labels, labels)...).Set(value)
+		}
+	}
+}
+
+// Close does nothing as metrics are scraped
+func (b *PrometheusBackend) Close() {}
+
+func (b *PrometheusBackend) counter(name string, labels map[string]string) *labelledVec[*prometheus.CounterVec] {
+	if counter, ok := b.counters[name]; ok {
+		return counter
+	}
+	labelNames := sortedKeys(labels)
+	counter := &labelledVec[*prometheus.CounterVec]{
+		vec: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: b.namespace,
+			Name:      name + "_total",
+			Help:      "How many " + name + " measurements have been recorded.",
+		}, labelNames),
+		labels: labelNames,
+	}
+	b.registry.MustRegister(counter.vec)
+	b.counters[name] = counter
+	return counter
+}
+
+func (b *PrometheusBackend) histogram(name, help string, buckets []float64, labels map[string]string) *labelledVec[*prometheus.HistogramVec] {
+	if histogram, ok := b.histograms[name]; ok {
+		return histogram
+	}
+	labelNames := sortedKeys(labels)
+	histogram := &labelledVec[*prometheus.HistogramVec]{
+		vec: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: b.namespace,
+			Name:      name,
+			Help:      help,
+			Buckets:   buckets,
+		}, labelNames),
+		labels: labelNames,
+	}
+	b.registry.MustRegister(histogram.vec)
+	b.histograms[name] = histogram
+	return histogram
+}
+
+func (b *PrometheusBackend) gauge(name string, labels map[string]string) *labelledVec[*prometheus.GaugeVec] {
+	if gauge, ok := b.gauges[name]; ok {
+		return gauge
+	}
+	labelNames := sortedKeys(labels)
+	gauge := &labelledVec[*prometheus.GaugeVec]{
+		vec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: b.namespace,
+			Name:      name,
+			Help:      "The last " + name + " recorded.",
+		}, labelNames),
+		labels: labelNames,
+	}
+	b.registry.MustRegister(gauge.vec)
+	b.gauges[name] = gauge
+	return gauge
+}
+
+// labelValues returns the values for the given label names. The label names of a metric are
+// fixed when it is first recorded, so missing labels are left empty and new labels are dropped
+func labelValues(names []string, labels map[string]string) []string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = labels[name]
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
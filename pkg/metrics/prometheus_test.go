@@ -0,0 +1,38 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/metrics"
+)
+
+func TestPrometheusBackendExposesMetrics(t *testing.T) {
+	client := metrics.New(metrics.NewPrometheusBackend("blog"), metrics.WithDefaultTags(map[string]string{"environment": "test"}))
+	client.Indexed(time.Now().Add(-50*time.Millisecond), 2, 5)
+	client.ReadFile("markdown")
+	client.WithTags(map[string]string{"tenant": "notes"}).ContentUpdated(time.Now())
+	client.Request("/topics/{topic}", "GET", 404, 300, time.Now())
+
+	recorder := httptest.NewRecorder()
+	client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `blog_indexed_total{environment="test"} 1`)
+	require.Contains(t, string(body), `blog_indexed_duration_seconds_bucket{environment="test",le="0.1"} 1`)
+	require.Contains(t, string(body), `blog_indexed_article_count{environment="test"} 5`)
+	require.Contains(t, string(body), `blog_read_file_total{environment="test",file_type="markdown"} 1`)
+	require.Contains(t, string(body), `blog_content_updated_total{environment="test",tenant="notes"} 1`)
+	require.Contains(t, string(body), `blog_request_total{environment="test",method="GET",route="/topics/{topic}",status_class="4xx"} 1`)
+	require.Contains(t, string(body), `blog_request_response_bytes_bucket{environment="test",method="GET",route="/topics/{topic}",status_class="4xx",le="1024"} 1`)
+}
+
+func TestNoopBackendHasNoHandler(t *testing.T) {
+	client := metrics.New(metrics.NewNoopBackend())
+	client.Indexed(time.Now(), 1, 1)
+	require.Nil(t, client.Handler())
+}
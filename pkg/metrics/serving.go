@@ -1,15 +1,34 @@
 package metrics
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
-// Request records how many requests the server has handled
-func (c *Client) Request(uri string, startTime time.Time) {
+// Request records how many requests the server has handled. The route is the template of the
+// matched route rather than the requested URI to keep the number of series small
+func (c *Client) Request(route, method string, status int, bytes int64, startTime time.Time) {
 	fields := map[string]interface{}{
-		"time_taken_ms": time.Since(startTime).Milliseconds(),
-		"count":         1,
+		"time_taken_ms":  time.Since(startTime).Milliseconds(),
+		"count":          1,
+		"response_bytes": bytes,
 	}
 	tags := map[string]string{
-		"uri": uri,
+		"route":        route,
+		"method":       method,
+		"status_class": fmt.Sprintf("%dxx", status/100),
 	}
 	c.publish("request", fields, tags)
 }
+
+// ContentViewed records a view of a topic, or of an article if one is given
+func (c *Client) ContentViewed(topic, article string) {
+	fields := map[string]interface{}{
+		"count": 1,
+	}
+	tags := map[string]string{
+		"topic":   topic,
+		"article": article,
+	}
+	c.publish("content_view", fields, tags)
+}
@@ -13,14 +13,37 @@ type Article struct {
 	URI       string
 	Hidden    bool
 
+	// Source is the name of the content source which provided the article
+	Source   string
 	FilePath string
 
 	PublishedAt int64
 	UpdatedAt   int64
-	Priority    int64
-	Metadata    map[string]string
+	// ExpiresAt is when the article is removed from listings, zero if it never expires
+	ExpiresAt int64
+	Priority  int64
+	// Order is the position of the article within its topic and series, zero if not given
+	Order int64
+	// Series is the title of the series the article belongs to, empty if none
+	Series   string
+	Tags     []string
+	Metadata map[string]string
+
+	// Links holds the file paths of the content which the article links to
+	Links []string
+
+	// Related holds the articles given in the related header, as "<topic>/<article>" or just
+	// "<article>" within the same topic
+	Related []string
+	// Terms holds how often each meaningful word appears in the article
+	Terms map[string]int
 }
 
 func (a *Article) IsPublished() bool {
-	return a.PublishedAt > 0 && !a.Hidden && a.PublishedAt < time.Now().Unix()
+	return a.PublishedAt > 0 && !a.Hidden && a.PublishedAt <= time.Now().Unix() && !a.IsExpired()
+}
+
+// IsExpired returns true once the article's expiry time has passed
+func (a *Article) IsExpired() bool {
+	return a.ExpiresAt > 0 && a.ExpiresAt <= time.Now().Unix()
 }
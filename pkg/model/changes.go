@@ -0,0 +1,17 @@
+package model
+
+// ContentChanges defines a set of changes to the content which are applied together
+type ContentChanges struct {
+	// Topics and Articles hold everything which is new or has changed
+	Topics   []*Topic
+	Articles []*Article
+	// DeletedTopics and DeletedArticles hold everything which has been removed. Only their
+	// slugs, source and file path are set. The articles of a deleted topic are also deleted
+	DeletedTopics   []*Topic
+	DeletedArticles []*Article
+}
+
+// IsEmpty reports whether there are no changes
+func (c *ContentChanges) IsEmpty() bool {
+	return len(c.Topics) == 0 && len(c.Articles) == 0 && len(c.DeletedTopics) == 0 && len(c.DeletedArticles) == 0
+}
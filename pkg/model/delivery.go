@@ -0,0 +1,19 @@
+package model
+
+// Delivery defines an attempt to deliver an event to a webhook
+type Delivery struct {
+	ID        string
+	EventID   string
+	EventType string
+	Webhook   string
+
+	Attempts   int
+	StatusCode int
+	Error      string
+	Delivered  bool
+	// Failed is set once every attempt has been made without the event being delivered
+	Failed bool
+
+	CreatedAt     int64
+	LastAttemptAt int64
+}
@@ -0,0 +1,34 @@
+package model
+
+// The types of node and edge in the content graph
+const (
+	GraphNodeTopic   = "topic"
+	GraphNodeArticle = "article"
+	// GraphEdgeLink joins an article to the content it links to
+	GraphEdgeLink = "link"
+	// GraphEdgeTopic joins an article to its topic
+	GraphEdgeTopic = "topic"
+)
+
+// Graph defines how the published content links together
+type Graph struct {
+	Nodes []*GraphNode
+	Edges []*GraphEdge
+}
+
+// GraphNode defines a topic or article in the content graph
+type GraphNode struct {
+	// ID is "topic:<topic>" for topics and "article:<topic>/<article>" for articles
+	ID        string
+	Type      string
+	Title     string
+	TopicSlug string
+	Slug      string
+}
+
+// GraphEdge defines a connection between two nodes of the content graph
+type GraphEdge struct {
+	Source string
+	Target string
+	Type   string
+}
@@ -0,0 +1,11 @@
+package model
+
+// FailedInvalidation defines a path which could not be invalidated
+type FailedInvalidation struct {
+	Target   string
+	Path     string
+	Attempts int
+	Error    string
+
+	FailedAt int64
+}
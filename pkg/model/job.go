@@ -0,0 +1,15 @@
+package model
+
+// Job defines the status of a scheduled job
+type Job struct {
+	Name     string
+	Schedule string
+	Running  bool
+	Runs     int
+
+	LastRunAt int64
+	// LastDuration is how long the last run took in milliseconds
+	LastDuration int64
+	LastError    string
+	NextRunAt    int64
+}
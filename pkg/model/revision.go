@@ -0,0 +1,35 @@
+package model
+
+// Revision defines a single change made to a content file
+type Revision struct {
+	SHA     string
+	Author  string
+	Message string
+
+	Date int64
+}
+
+// ContentRevision defines a version of the whole content directory which has been staged
+type ContentRevision struct {
+	ID       string
+	Source   string
+	StagedAt int64
+
+	// Live is set on the revision currently being served
+	Live bool
+	// Rejected is set when the revision failed validation, along with the problems found
+	Rejected bool
+	Problems []string
+}
+
+// UpdaterState defines what an updater needs to carry on where it left off after a restart
+type UpdaterState struct {
+	// Checksums holds the checksum of every content file when it was last read
+	Checksums map[string]string
+	// Slugs holds the slug each file was last read as, "<topic>/<article>" for articles
+	Slugs map[string]string
+	// Revisions holds the staged content revisions, newest first
+	Revisions []*ContentRevision
+	// PinnedRevision is the staged revision which is ignored after a rollback
+	PinnedRevision string
+}
@@ -0,0 +1,21 @@
+package model
+
+import "strings"
+
+// Series defines a group of articles, possibly from several topics, which are read in order
+type Series struct {
+	Title string
+	Slug  string
+	// Articles holds the published articles of the series in order
+	Articles []*Article
+}
+
+// SeriesSlug returns the slug of the series the article belongs to, empty if none
+func (a *Article) SeriesSlug() string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(strings.TrimSpace(a.Series))), "-")
+}
@@ -1,19 +1,72 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
+// The ways the articles within a topic can be ordered
+const (
+	// OrderPublished orders articles by when they were published, oldest first
+	OrderPublished = "published"
+	// OrderPriority orders articles by their priority, highest first
+	OrderPriority = "priority"
+	// OrderList orders articles by the numbered list of links in the topic file
+	OrderList = "list"
+)
+
+// ReservedSubtopicSlugs are the path segments which follow a topic slug in the API routes, so
+// a subtopic cannot use them as its own slug
+var ReservedSubtopicSlugs = []string{"articles", "related", "revisions"}
+
 // Topic defines a topic entry
 type Topic struct {
 	Title       string
 	Description string
 	Image       string
 
-	Slug   string
-	URI    string
-	Hidden bool
+	// Slug is the path of the topic from the top level topic, such as "<parent>/<child>"
+	Slug string
+	URI  string
+	// ParentSlug is the slug of the topic which the topic is nested within, empty at the top level
+	ParentSlug string
+	// Children holds the slugs of the topics nested directly within the topic
+	Children []string
+	Hidden   bool
 
+	// Source is the name of the content source which provided the topic
+	Source   string
 	FilePath string
 
 	Priority    int64
 	PublishedAt int64
 	UpdatedAt   int64
-	Metadata    map[string]string
+	// ExpiresAt is when the topic and its articles are removed from listings, zero if it never expires
+	ExpiresAt int64
+	Metadata  map[string]string
+
+	// Order is how the articles within the topic are ordered
+	Order string
+	// OrderedFiles holds the file paths of the articles in the order they are listed in the
+	// topic file, only when ordered by list
+	OrderedFiles []string
+}
+
+// HasReservedSlug returns true if the topic is a subtopic whose slug ends in a reserved segment
+func (t *Topic) HasReservedSlug() bool {
+	if t.ParentSlug == "" {
+		return false
+	}
+	leaf := t.Slug[strings.LastIndex(t.Slug, "/")+1:]
+	for _, reserved := range ReservedSubtopicSlugs {
+		if leaf == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired returns true once the topic's expiry time has passed
+func (t *Topic) IsExpired() bool {
+	return t.ExpiresAt > 0 && t.ExpiresAt <= time.Now().Unix()
 }
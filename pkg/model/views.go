@@ -0,0 +1,8 @@
+package model
+
+// ArticleViews holds how many times an article has been viewed
+type ArticleViews struct {
+	TopicSlug   string
+	ArticleSlug string
+	Views       int
+}
@@ -0,0 +1,88 @@
+package notifying
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// The types of event which can be sent
+const (
+	ArticlePublished   = "article.published"
+	ArticleUpdated     = "article.updated"
+	ArticleUnpublished = "article.unpublished"
+	TopicCreated       = "topic.created"
+)
+
+// Event defines the body sent to webhooks
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt int64       `json:"occurredAt"`
+	Tenant     string      `json:"tenant,omitempty"`
+	Data       interface{} `json:"data"`
+}
+
+// ArticleData defines the article sent with article events
+type ArticleData struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Slug        string   `json:"slug"`
+	TopicSlug   string   `json:"topicSlug"`
+	URI         string   `json:"uri"`
+	Tags        []string `json:"tags"`
+	PublishedAt int64    `json:"publishedAt"`
+	UpdatedAt   int64    `json:"updatedAt"`
+}
+
+// TopicData defines the topic sent with topic events
+type TopicData struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Slug        string `json:"slug"`
+	URI         string `json:"uri"`
+}
+
+func newEvent(eventType, tenant string, data interface{}) *Event {
+	return &Event{
+		ID:         newID(),
+		Type:       eventType,
+		OccurredAt: time.Now().Unix(),
+		Tenant:     tenant,
+		Data:       data,
+	}
+}
+
+func articleData(article *model.Article) ArticleData {
+	tags := article.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return ArticleData{
+		Title:       article.Title,
+		Description: article.Description,
+		Slug:        article.Slug,
+		TopicSlug:   article.TopicSlug,
+		URI:         article.URI,
+		Tags:        tags,
+		PublishedAt: article.PublishedAt,
+		UpdatedAt:   article.UpdatedAt,
+	}
+}
+
+func topicData(topic *model.Topic) TopicData {
+	return TopicData{
+		Title:       topic.Title,
+		Description: topic.Description,
+		Slug:        topic.Slug,
+		URI:         topic.URI,
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,288 @@
+package notifying
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/signing"
+)
+
+const (
+	// EventHeader holds the type of the event
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader holds the ID of the delivery, which is the same for every attempt
+	DeliveryHeader = "X-Webhook-Delivery"
+	// TimestampHeader holds the unix time the request was signed at
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Metrics defines the metrics used by the notifier
+type Metrics interface {
+	EventDelivered(webhook, eventType string, startTime time.Time, success bool)
+}
+
+// Webhook defines somewhere events are sent to
+type Webhook struct {
+	Name string
+	URL  string
+	// Secret is used to sign every request, if set
+	Secret string
+	// Events holds the types of event to send, every event is sent if it is empty
+	Events []string
+}
+
+type delivery struct {
+	record  *model.Delivery
+	webhook *Webhook
+	body    []byte
+}
+
+// Notifier sends events to webhooks in the background, retrying failed deliveries with an
+// exponential backoff and keeping a log of recent deliveries
+type Notifier struct {
+	webhooks   []*Webhook
+	tenant     string
+	metrics    Metrics
+	httpClient *http.Client
+
+	queue      chan *delivery
+	deliveries []*model.Delivery
+	lock       sync.Mutex
+
+	queueSize      int
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxDeliveries  int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Option defines the function used to set options
+type Option func(*Notifier)
+
+// WithTenant specifies the tenant which is included in every event
+func WithTenant(tenant string) Option {
+	return func(n *Notifier) {
+		n.tenant = tenant
+	}
+}
+
+// WithRetries specifies how many times a delivery is attempted, along with the backoff between
+// attempts which doubles after every failure
+func WithRetries(maxAttempts int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(n *Notifier) {
+		n.maxAttempts = maxAttempts
+		n.initialBackoff = initialBackoff
+		n.maxBackoff = maxBackoff
+	}
+}
+
+// WithMaxDeliveries specifies how many deliveries are kept in the delivery log
+func WithMaxDeliveries(maxDeliveries int) Option {
+	return func(n *Notifier) {
+		n.maxDeliveries = maxDeliveries
+	}
+}
+
+// New creates a new notifier which sends events to the given webhooks
+func New(webhooks []*Webhook, metrics Metrics, opts ...Option) *Notifier {
+	n := &Notifier{
+		webhooks:       webhooks,
+		metrics:        metrics,
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+		deliveries:     []*model.Delivery{},
+		queueSize:      1000,
+		maxAttempts:    8,
+		initialBackoff: 5 * time.Second,
+		maxBackoff:     10 * time.Minute,
+		maxDeliveries:  200,
+		done:           make(chan struct{}),
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	n.queue = make(chan *delivery, n.queueSize)
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	go n.run()
+
+	return n
+}
+
+// NotifyArticle sends an article event to every webhook which subscribes to it
+func (n *Notifier) NotifyArticle(eventType string, article *model.Article) {
+	n.notify(newEvent(eventType, n.tenant, articleData(article)))
+}
+
+// NotifyTopic sends a topic event to every webhook which subscribes to it
+func (n *Notifier) NotifyTopic(eventType string, topic *model.Topic) {
+	n.notify(newEvent(eventType, n.tenant, topicData(topic)))
+}
+
+// GetDeliveries returns the delivery log, newest first
+func (n *Notifier) GetDeliveries() []*model.Delivery {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	deliveries := make([]*model.Delivery, len(n.deliveries))
+	for i, record := range n.deliveries {
+		copied := *record
+		deliveries[len(n.deliveries)-1-i] = &copied
+	}
+	return deliveries
+}
+
+// Shutdown stops the notifier once the current delivery attempt has finished. Anything still
+// queued is abandoned
+func (n *Notifier) Shutdown() {
+	slog.Info("notifier shutting down")
+	n.cancel()
+	<-n.done
+}
+
+func (n *Notifier) notify(event *Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode event", "event", event.Type, "error", err)
+		sentry.CaptureException(errors.Wrap(err, "failed to encode event"))
+		return
+	}
+
+	for _, webhook := range n.webhooks {
+		if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, event.Type) {
+			continue
+		}
+
+		record := &model.Delivery{
+			ID:        newID(),
+			EventID:   event.ID,
+			EventType: event.Type,
+			Webhook:   webhook.Name,
+			CreatedAt: time.Now().Unix(),
+		}
+		n.lock.Lock()
+		n.deliveries = append(n.deliveries, record)
+		if len(n.deliveries) > n.maxDeliveries {
+			n.deliveries = n.deliveries[len(n.deliveries)-n.maxDeliveries:]
+		}
+		n.lock.Unlock()
+
+		n.push(&delivery{record: record, webhook: webhook, body: body})
+	}
+}
+
+// push adds the delivery to the queue without blocking. If the queue is full, the delivery fails
+func (n *Notifier) push(d *delivery) {
+	select {
+	case n.queue <- d:
+	default:
+		n.fail(d, errors.New("event queue is full"))
+	}
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case d := <-n.queue:
+			n.deliver(d)
+		}
+	}
+}
+
+func (n *Notifier) deliver(d *delivery) {
+	startTime := time.Now()
+	statusCode, err := n.send(d)
+	n.metrics.EventDelivered(d.webhook.Name, d.record.EventType, startTime, err == nil)
+
+	n.lock.Lock()
+	d.record.Attempts++
+	d.record.StatusCode = statusCode
+	d.record.LastAttemptAt = startTime.Unix()
+	d.record.Delivered = err == nil
+	d.record.Error = ""
+	if err != nil {
+		d.record.Error = err.Error()
+	}
+	attempts := d.record.Attempts
+	n.lock.Unlock()
+
+	if err == nil {
+		slog.Info("delivered event", "webhook", d.webhook.Name, "event", d.record.EventType, "delivery", d.record.ID)
+		return
+	}
+
+	slog.Warn("failed to deliver event", "webhook", d.webhook.Name, "event", d.record.EventType, "attempt", attempts, "error", err)
+	if attempts >= n.maxAttempts {
+		n.fail(d, err)
+		return
+	}
+	time.AfterFunc(n.backoff(attempts), func() {
+		n.push(d)
+	})
+}
+
+func (n *Notifier) send(d *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, d.webhook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.record.EventType)
+	req.Header.Set(DeliveryHeader, d.record.ID)
+	if d.webhook.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, signing.Sign(d.webhook.Secret, timestamp, d.body))
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to send event to %s", d.webhook.Name)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.Errorf("failed to send event to %s: unexpected status %d", d.webhook.Name, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns how long to wait before the next attempt
+func (n *Notifier) backoff(attempts int) time.Duration {
+	backoff := n.initialBackoff
+	for i := 1; i < attempts && backoff < n.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, n.maxBackoff)
+}
+
+func (n *Notifier) fail(d *delivery, err error) {
+	slog.Error("giving up delivering event", "webhook", d.webhook.Name, "event", d.record.EventType, "delivery", d.record.ID, "error", err)
+	sentry.CaptureException(errors.Wrapf(err, "failed to deliver %s event to %s", d.record.EventType, d.webhook.Name))
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	d.record.Failed = true
+	d.record.Error = err.Error()
+}
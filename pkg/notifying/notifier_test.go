@@ -0,0 +1,64 @@
+package notifying_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/notifying"
+	"github.com/wamphlett/blog-server/pkg/signing"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) EventDelivered(webhook, eventType string, startTime time.Time, success bool) {}
+
+func TestNotifierRetriesSignedDeliveries(t *testing.T) {
+	lock := sync.Mutex{}
+	attempts := 0
+	events := []notifying.Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, signing.Sign("secret", r.Header.Get(notifying.TimestampHeader), body), r.Header.Get(notifying.SignatureHeader))
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		event := notifying.Event{}
+		require.NoError(t, json.Unmarshal(body, &event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := notifying.New([]*notifying.Webhook{
+		{Name: "newsletter", URL: server.URL, Secret: "secret", Events: []string{notifying.ArticlePublished}},
+	}, noopMetrics{}, notifying.WithRetries(3, 10*time.Millisecond, 10*time.Millisecond))
+	defer notifier.Shutdown()
+
+	notifier.NotifyTopic(notifying.TopicCreated, &model.Topic{Slug: "ignored"})
+	notifier.NotifyArticle(notifying.ArticlePublished, &model.Article{Slug: "article", TopicSlug: "topic"})
+
+	require.Eventually(t, func() bool {
+		deliveries := notifier.GetDeliveries()
+		return len(deliveries) == 1 && deliveries[0].Delivered
+	}, time.Second, 10*time.Millisecond)
+
+	delivery := notifier.GetDeliveries()[0]
+	require.Equal(t, "newsletter", delivery.Webhook)
+	require.Equal(t, 2, delivery.Attempts)
+	require.Len(t, events, 1)
+	require.Equal(t, notifying.ArticlePublished, events[0].Type)
+	require.Equal(t, delivery.EventID, events[0].ID)
+}
@@ -1,6 +1,9 @@
 package reading
 
 import (
+	"context"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -9,14 +12,14 @@ import (
 )
 
 // loadArticleFromPath reads the given file path and creates a new article
-func (r *Reader) LoadArticleFromFile(articleFilePath, topicSlug string) *model.Article {
+func (r *Reader) LoadArticleFromFile(ctx context.Context, articleFilePath, topicSlug string) *model.Article {
 	article := &model.Article{
 		FilePath:  articleFilePath,
 		TopicSlug: topicSlug,
 		Metadata:  map[string]string{},
 	}
 
-	headers := r.parseFileHeaders(articleFilePath)
+	headers := r.parseFileHeaders(ctx, articleFilePath)
 
 	for header, value := range headers {
 		switch header {
@@ -24,6 +27,8 @@ func (r *Reader) LoadArticleFromFile(articleFilePath, topicSlug string) *model.A
 			article.PublishedAt = convertToTimestamp(value)
 		case "updated":
 			article.UpdatedAt = convertToTimestamp(value)
+		case "expires", "unpublish":
+			article.ExpiresAt = convertToTimestamp(value)
 		case "hidden":
 			article.Hidden = value == "true"
 		case "slug":
@@ -36,6 +41,16 @@ func (r *Reader) LoadArticleFromFile(articleFilePath, topicSlug string) *model.A
 			article.Image = value
 		case "priority":
 			article.Priority, _ = strconv.ParseInt(value, 10, 64)
+		case "tags":
+			// tags are also kept in the metadata for existing consumers
+			article.Tags = parseList(value)
+			article.Metadata[header] = value
+		case "related":
+			article.Related = parseList(value)
+		case "order":
+			article.Order, _ = strconv.ParseInt(value, 10, 64)
+		case "series":
+			article.Series = value
 		default:
 			article.Metadata[header] = value
 		}
@@ -50,7 +65,30 @@ func (r *Reader) LoadArticleFromFile(articleFilePath, topicSlug string) *model.A
 		article.Title = filename
 	}
 
-	article.URI = filepath.Join("/", topicSlug, article.Slug)
+	article.URI = filepath.Join("/topics", topicSlug, "articles", article.Slug)
+
+	links, err := r.GetRelativeLinks(articleFilePath)
+	if err != nil {
+		slog.Warn("failed to read article links", "file", articleFilePath, "error", err)
+	}
+	article.Links = links
+
+	contents, err := os.ReadFile(articleFilePath)
+	if err != nil {
+		slog.Warn("failed to read article terms", "file", articleFilePath, "error", err)
+	}
+	article.Terms = extractTerms(article.Title, article.Description, string(contents))
 
 	return article
 }
+
+// parseList splits a comma separated header into its lower case values
+func parseList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -2,6 +2,7 @@ package reading
 
 import (
 	"bufio"
+	"context"
 	"os"
 	"strings"
 	"time"
@@ -10,14 +11,43 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (r *Reader) parseFileHeaders(path string) (headers map[string]string) {
+// CheckFileHeaders parses the headers of the file at the given path and returns any problems
+// found with them
+func (r *Reader) CheckFileHeaders(path string) []error {
+	headers, problems := r.readFileHeaders(path)
+	for _, header := range []string{"published", "updated", "expires", "unpublish"} {
+		if value, ok := headers[header]; ok {
+			if _, err := parseDate(value); err != nil {
+				problems = append(problems, errors.Wrapf(err, "invalid %s header in file: %s", header, path))
+			}
+		}
+	}
+	return problems
+}
+
+func (r *Reader) parseFileHeaders(ctx context.Context, path string) (headers map[string]string) {
+	_, span := tracer.Start(ctx, "Reader.parseFileHeaders", trace.WithAttributes(attribute.String("file.path", path)))
+	defer span.End()
+
+	headers, problems := r.readFileHeaders(path)
+	for _, problem := range problems {
+		span.RecordError(problem)
+	}
+	return
+}
+
+func (r *Reader) readFileHeaders(path string) (headers map[string]string, problems []error) {
 	headers = make(map[string]string)
 	slog.Info("parsing file headers", "path", path)
 	file, err := os.Open(path)
 	if err != nil {
-		sentry.CaptureException(errors.Wrap(err, "failed to parse file headers"))
+		err = errors.Wrap(err, "failed to parse file headers")
+		sentry.CaptureException(err)
+		problems = append(problems, err)
 		return
 	}
 	defer file.Close()
@@ -58,7 +88,9 @@ func (r *Reader) parseFileHeaders(path string) (headers map[string]string) {
 
 		if colonIndex == -1 {
 			slog.Warn("invalid headers in file", "path", path, "line", t)
-			sentry.CaptureException(errors.Errorf("invalid headers in file: %s (%s)", path, t))
+			err := errors.Errorf("invalid headers in file: %s (%s)", path, t)
+			sentry.CaptureException(err)
+			problems = append(problems, err)
 
 			continue
 		}
@@ -73,11 +105,47 @@ func (r *Reader) parseFileHeaders(path string) (headers map[string]string) {
 }
 
 func convertToTimestamp(dateStr string) int64 {
-	parsedDate, err := time.Parse("2006-01-02", dateStr)
+	timestamp, err := parseDate(dateStr)
 	if err != nil {
 		slog.Error("failed to parse date", "date", dateStr, "error", err)
 		sentry.CaptureException(errors.Wrapf(err, "failed to parse date: %s", dateStr))
 		return 0
 	}
-	return parsedDate.Unix()
+	return timestamp
+}
+
+// dateFormats holds the accepted date formats. Dates without an offset are in UTC unless they
+// are followed by a time zone name
+var dateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate parses a date, optionally with a time and a time zone, such as 2024-01-15,
+// 2024-01-15T09:30:00+01:00 or 2024-01-15 09:30 Europe/London
+func parseDate(dateStr string) (int64, error) {
+	dateStr = strings.TrimSpace(dateStr)
+	location := time.UTC
+	// times always contain a colon, so anything else following a space is a time zone
+	if i := strings.LastIndex(dateStr, " "); i > 0 && !strings.Contains(dateStr[i+1:], ":") {
+		loc, err := time.LoadLocation(dateStr[i+1:])
+		if err != nil {
+			return 0, errors.Wrapf(err, "unknown time zone: %s", dateStr[i+1:])
+		}
+		location = loc
+		dateStr = strings.TrimSpace(dateStr[:i])
+	}
+
+	var err error
+	for _, format := range dateFormats {
+		var parsedDate time.Time
+		if parsedDate, err = time.ParseInLocation(format, dateStr, location); err == nil {
+			return parsedDate.Unix(), nil
+		}
+	}
+	return 0, err
 }
@@ -2,6 +2,7 @@ package reading
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,8 +16,18 @@ import (
 	"github.com/pkg/errors"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/renderer/html"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/wamphlett/blog-server/pkg/reading")
+
+var relativeLinkRegex = regexp.MustCompile(`(\[[\w\d\s\-!?]*\]\()(\.[\/\.\w\d\-]*)\)`)
+
+var numberedListItemRegex = regexp.MustCompile(`^\s*\d+[.)]\s`)
+
 // Metrics defines the metrics used by the reader
 type Metrics interface {
 	ParseFile(startTime time.Time)
@@ -47,21 +58,40 @@ func New(index Index, staticContentURL, staticContentDir string, metrics Metrics
 }
 
 // ReadFileAsHTML reads the markdown file at the given location and returns the HTML version
-func (r *Reader) ReadFileAsHTML(filepath string) (string, error) {
+func (r *Reader) ReadFileAsHTML(ctx context.Context, filepath string) (string, error) {
+	ctx, span := tracer.Start(ctx, "Reader.ReadFileAsHTML", trace.WithAttributes(attribute.String("file.path", filepath)))
+	defer span.End()
+
 	startTime := time.Now()
 	defer r.metrics.ParseFile(startTime)
 
+	_, readSpan := tracer.Start(ctx, "os.ReadFile")
 	b, err := os.ReadFile(filepath)
+	readSpan.End()
 	if err != nil {
 		slog.Error("failed to read file", "path", filepath, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to read file")
 		return "", errors.Wrap(err, "failed to read article file")
 	}
 
-	contents := stripMarkdownProperties(string(b))
+	return r.RenderHTML(ctx, b, filepath)
+}
 
+// RenderHTML converts the given markdown contents to HTML. The file path is used to resolve
+// any relative links within the contents
+func (r *Reader) RenderHTML(ctx context.Context, b []byte, filepath string) (string, error) {
+	ctx, span := tracer.Start(ctx, "Reader.RenderHTML", trace.WithAttributes(attribute.Int("file.size", len(b))))
+	defer span.End()
+
+	_, rewriteSpan := tracer.Start(ctx, "Reader.rewriteLinks")
+	contents := stripMarkdownProperties(string(b))
 	contents = r.replaceRelativeLinks(contents, filepath)
 	contents = r.replaceImageLinks(contents)
+	rewriteSpan.End()
 
+	_, convertSpan := tracer.Start(ctx, "goldmark.Convert")
+	defer convertSpan.End()
 	md := goldmark.New(
 		goldmark.WithRendererOptions(
 			html.WithUnsafe(),
@@ -71,6 +101,8 @@ func (r *Reader) ReadFileAsHTML(filepath string) (string, error) {
 	if err := md.Convert([]byte(contents), &buf); err != nil {
 		slog.Error("failed to parse markdown", "path", filepath, "error", err)
 		sentry.CaptureException(errors.Wrapf(err, "failed to parse file: %s", filepath))
+		convertSpan.RecordError(err)
+		convertSpan.SetStatus(codes.Error, "failed to parse markdown")
 	}
 
 	return buf.String(), nil
@@ -81,10 +113,44 @@ func stripMarkdownProperties(s string) string {
 	return regex.ReplaceAllString(s, "")
 }
 
+// GetRelativeLinks returns the paths of all the files linked to by relative links in the file
+// at the given path
+func (r *Reader) GetRelativeLinks(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read file links")
+	}
+
+	links := []string{}
+	for _, match := range relativeLinkRegex.FindAllStringSubmatch(stripMarkdownProperties(string(b)), -1) {
+		links = append(links, filepath.Clean(filepath.Join(filepath.Dir(path), match[2])))
+	}
+	return links, nil
+}
+
+// GetListedLinks returns the paths of the files linked to by relative links in the numbered
+// lists of the file at the given path, in the order they are listed
+func (r *Reader) GetListedLinks(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read file links")
+	}
+
+	links := []string{}
+	for _, line := range strings.Split(stripMarkdownProperties(string(b)), "\n") {
+		if !numberedListItemRegex.MatchString(line) {
+			continue
+		}
+		for _, match := range relativeLinkRegex.FindAllStringSubmatch(line, -1) {
+			links = append(links, filepath.Clean(filepath.Join(filepath.Dir(path), match[2])))
+		}
+	}
+	return links, nil
+}
+
 // replaceRelativeLinks replaces all relative links in the content with the absolute URI
 func (r *Reader) replaceRelativeLinks(s, path string) string {
-	reg := regexp.MustCompile(`(\[[\w\d\s\-!?]*\]\()(\.[\/\.\w\d\-]*)\)`)
-	for _, match := range reg.FindAllStringSubmatch(s, -1) {
+	for _, match := range relativeLinkRegex.FindAllStringSubmatch(s, -1) {
 		linkedFilePath := filepath.Clean(filepath.Join(filepath.Dir(path), match[2]))
 		if p := r.index.GetURIForFile(linkedFilePath); p != "" {
 			s = strings.ReplaceAll(s, match[0], fmt.Sprintf("%s%s)", match[1], p))
@@ -1,10 +1,14 @@
 package reading_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/model"
 	"github.com/wamphlett/blog-server/pkg/reading"
 )
 
@@ -13,10 +17,90 @@ type MockMetrics struct{}
 func (m *MockMetrics) ParseFile(startTime time.Time)    {}
 func (m *MockMetrics) ParseHeaders(startTime time.Time) {}
 
+// MockIndex finds the URIs of the files it has been given
+type MockIndex map[string]string
+
+func (i MockIndex) GetURIForFile(filepath string) string { return i[filepath] }
+
+func TestRewritesRelativeLinksToTopicsAndArticles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go/README.md":          "# Go\n",
+		"go/channels.md":        "# Channels\n",
+		"go/testing/README.md":  "# Testing\n",
+		"go/testing/mocks.md":   "# Mocks\n",
+		"go/testing/linking.md": "[Go](../README.md) [Channels](../channels.md) [Testing](./README.md) [Mocks](./mocks.md)\n",
+	}
+	for path, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(contents), 0o644))
+	}
+
+	loader := reading.New(nil, "", "", &MockMetrics{})
+	index := MockIndex{}
+	for _, topic := range []*model.Topic{
+		loader.LoadTopicFromFile(context.Background(), filepath.Join(dir, "go", "README.md"), ""),
+		loader.LoadTopicFromFile(context.Background(), filepath.Join(dir, "go", "testing", "README.md"), "go"),
+	} {
+		index[topic.FilePath] = topic.URI
+	}
+	for path, topicSlug := range map[string]string{"go/channels.md": "go", "go/testing/mocks.md": "go/testing"} {
+		article := loader.LoadArticleFromFile(context.Background(), filepath.Join(dir, path), topicSlug)
+		index[article.FilePath] = article.URI
+	}
+
+	html, err := reading.New(index, "", "images", &MockMetrics{}).ReadFileAsHTML(context.Background(), filepath.Join(dir, "go", "testing", "linking.md"))
+	require.NoError(t, err)
+	require.Equal(t, `<p><a href="/topics/go">Go</a> <a href="/topics/go/articles/channels">Channels</a> `+
+		`<a href="/topics/go/testing">Testing</a> <a href="/topics/go/testing/articles/mocks">Mocks</a></p>`+"\n", html)
+}
+
 func TestReadsFileAsHTMLStripsProperties(t *testing.T) {
 	reader := reading.New(nil, "", "", &MockMetrics{})
-	html, err := reader.ReadFileAsHTML("../../test/testdata/content/topic-one/file-with-properties.md")
+	html, err := reader.ReadFileAsHTML(context.Background(), "../../test/testdata/content/topic-one/file-with-properties.md")
 	require.NoError(t, err)
 
 	require.Equal(t, "<!--\ntitle: some title\n-->\n<h1>Post</h1>\n<p>With some properties</p>\n<hr>\n<h2>more: properties</h2>\n", html)
 }
+
+func TestParsesPublishDatesWithTimesAndTimeZones(t *testing.T) {
+	reader := reading.New(nil, "", "", &MockMetrics{})
+	dir := t.TempDir()
+
+	for date, expected := range map[string]string{
+		"2024-01-15":                     "2024-01-15T00:00:00Z",
+		"2024-01-15 09:30":               "2024-01-15T09:30:00Z",
+		"2024-01-15T09:30:00+02:00":      "2024-01-15T07:30:00Z",
+		"2024-07-15 09:30 Europe/London": "2024-07-15T08:30:00Z",
+	} {
+		path := filepath.Join(dir, "article.md")
+		require.NoError(t, os.WriteFile(path, []byte("<!--\npublished: "+date+"\n-->\n# Article\n"), 0644))
+
+		article := reader.LoadArticleFromFile(context.Background(), path, "topic")
+		require.Equal(t, expected, time.Unix(article.PublishedAt, 0).UTC().Format(time.RFC3339), date)
+		require.Empty(t, reader.CheckFileHeaders(path), date)
+	}
+}
+
+func TestOrdersTopicArticlesByNumberedList(t *testing.T) {
+	reader := reading.New(nil, "", "", &MockMetrics{})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "README.md")
+	require.NoError(t, os.WriteFile(path, []byte("<!--\norder: list\n-->\n# Topic\n\n- [Unlisted](./unlisted.md)\n\n1. [Setup](./setup.md)\n2. [Next steps](./next.md)\n"), 0644))
+
+	topic := reader.LoadTopicFromFile(context.Background(), path, "")
+	require.Equal(t, model.OrderList, topic.Order)
+	require.Equal(t, []string{filepath.Join(dir, "setup.md"), filepath.Join(dir, "next.md")}, topic.OrderedFiles)
+}
+
+func TestNestsSubtopicSlugsUnderTheirParent(t *testing.T) {
+	reader := reading.New(nil, "", "", &MockMetrics{})
+	path := filepath.Join(t.TempDir(), "Testing", "README.md")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("<!--\ntitle: Testing\n-->\n# Testing\n"), 0644))
+
+	topic := reader.LoadTopicFromFile(context.Background(), path, "guides/go")
+	require.Equal(t, "guides/go/testing", topic.Slug)
+	require.Equal(t, "guides/go", topic.ParentSlug)
+	require.Equal(t, "/topics/guides/go/testing", topic.URI)
+}
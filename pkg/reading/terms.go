@@ -0,0 +1,88 @@
+package reading
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxTerms limits how many terms are kept for each article
+const maxTerms = 100
+
+// titleWeight is how many times each word of the title and description is counted, as they
+// say more about what an article is about than its body
+const titleWeight = 3
+
+var (
+	codeBlockRegex = regexp.MustCompile("(?s)```.*?```")
+	commentRegex   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	linkURLRegex   = regexp.MustCompile(`\]\([^)]*\)`)
+)
+
+// stopWords are common words which say nothing about what an article is about
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`about above after again against all also and any are because been before being
+		below between both but can could did does doing down during each few for from further had has have having her
+		here hers herself him himself his how into its itself just more most much must not now off once only other our
+		ours out over own same she should some such than that the their theirs them themselves then there these they
+		this those through too under until use used using very was were what when where which while who whom why will
+		with would you your yours yourself yourselves get got like make makes made one two way need want let lets
+		see new well may might really thing things http https www com`) {
+		stopWords[word] = true
+	}
+}
+
+// extractTerms counts the meaningful words in an article, leaving out code, links and common
+// words. Only the most frequent terms are kept
+func extractTerms(title, description, body string) map[string]int {
+	body = stripMarkdownProperties(body)
+	body = commentRegex.ReplaceAllString(body, " ")
+	body = codeBlockRegex.ReplaceAllString(body, " ")
+	body = linkURLRegex.ReplaceAllString(body, "]")
+
+	counts := map[string]int{}
+	for _, word := range tokenize(body) {
+		counts[word]++
+	}
+	for _, word := range tokenize(title + " " + description) {
+		counts[word] += titleWeight
+	}
+
+	if len(counts) <= maxTerms {
+		return counts
+	}
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+
+	terms := make(map[string]int, maxTerms)
+	for _, word := range words[:maxTerms] {
+		terms[word] = counts[word]
+	}
+	return terms
+}
+
+// tokenize splits the text into lower case words, leaving out short words, numbers and stop words
+func tokenize(text string) []string {
+	words := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < 3 || stopWords[word] || strings.IndexFunc(word, unicode.IsLetter) == -1 {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
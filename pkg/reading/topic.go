@@ -1,6 +1,8 @@
 package reading
 
 import (
+	"context"
+	"log/slog"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -8,14 +10,16 @@ import (
 	"github.com/wamphlett/blog-server/pkg/model"
 )
 
-// loadTopicFromFile creates a new topic from file at the given path
-func (r *Reader) LoadTopicFromFile(topicFilePath string) *model.Topic {
+// loadTopicFromFile creates a new topic from file at the given path, nested within the topic with
+// the given parent slug unless it is empty
+func (r *Reader) LoadTopicFromFile(ctx context.Context, topicFilePath, parentSlug string) *model.Topic {
 	topic := &model.Topic{
-		FilePath: topicFilePath,
-		Metadata: map[string]string{},
+		FilePath:   topicFilePath,
+		ParentSlug: parentSlug,
+		Metadata:   map[string]string{},
 	}
 
-	headers := r.parseFileHeaders(topicFilePath)
+	headers := r.parseFileHeaders(ctx, topicFilePath)
 
 	for header, value := range headers {
 		switch header {
@@ -23,6 +27,8 @@ func (r *Reader) LoadTopicFromFile(topicFilePath string) *model.Topic {
 			topic.PublishedAt = convertToTimestamp(value)
 		case "updated":
 			topic.UpdatedAt = convertToTimestamp(value)
+		case "expires", "unpublish":
+			topic.ExpiresAt = convertToTimestamp(value)
 		case "hidden":
 			topic.Hidden = value == "true"
 		case "slug":
@@ -35,6 +41,8 @@ func (r *Reader) LoadTopicFromFile(topicFilePath string) *model.Topic {
 			topic.Image = value
 		case "priority":
 			topic.Priority, _ = strconv.ParseInt(value, 10, 64)
+		case "order":
+			topic.Order = strings.ToLower(value)
 		default:
 			topic.Metadata[header] = value
 		}
@@ -50,7 +58,27 @@ func (r *Reader) LoadTopicFromFile(topicFilePath string) *model.Topic {
 		topic.Title = topicDirName
 	}
 
-	topic.URI = filepath.Join("/", topic.Slug)
+	// subtopics are found under the path of their parent
+	if parentSlug != "" {
+		topic.Slug = parentSlug + "/" + topic.Slug
+	}
+
+	topic.URI = filepath.Join("/topics", topic.Slug)
+
+	switch topic.Order {
+	case model.OrderPublished, model.OrderPriority:
+	case model.OrderList:
+		orderedFiles, err := r.GetListedLinks(topicFilePath)
+		if err != nil {
+			slog.Warn("failed to read topic article order", "file", topicFilePath, "error", err)
+		}
+		topic.OrderedFiles = orderedFiles
+	default:
+		if topic.Order != "" {
+			slog.Warn("unknown topic order, ordering by published", "file", topicFilePath, "order", topic.Order)
+		}
+		topic.Order = model.OrderPublished
+	}
 
 	return topic
 }
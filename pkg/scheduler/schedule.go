@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule defines when a job runs
+type Schedule interface {
+	// Next returns the next time the job should run after the given time, in the given time's
+	// location. A zero time means the job never runs again
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// interval runs a job on a fixed interval, with an optional random delay
+type interval struct {
+	every  time.Duration
+	jitter time.Duration
+}
+
+// Every creates a schedule which runs on the given interval. Every run is delayed by a random
+// amount up to the given jitter, so jobs on the same interval do not all run at once
+func Every(every, jitter time.Duration) Schedule {
+	return &interval{every: every, jitter: jitter}
+}
+
+func (i *interval) Next(after time.Time) time.Time {
+	next := after.Add(i.every)
+	if i.jitter > 0 {
+		next = next.Add(rand.N(i.jitter))
+	}
+	return next
+}
+
+func (i *interval) String() string {
+	if i.jitter > 0 {
+		return fmt.Sprintf("every %s ±%s", i.every, i.jitter)
+	}
+	return fmt.Sprintf("every %s", i.every)
+}
+
+// cron runs a job at the times matched by a cron expression
+type cron struct {
+	expression string
+
+	minutes, hours, days, months, weekdays uint64
+	// when both days and weekdays are restricted, either matching is enough
+	daysRestricted, weekdaysRestricted bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard five field cron expression (minute, hour, day of month, month
+// and day of week) or one of the @yearly, @monthly, @weekly, @daily and @hourly macros. Fields
+// support *, lists, ranges and steps, such as */15 or 1-5
+func ParseCron(expression string) (Schedule, error) {
+	fields := strings.Fields(expression)
+	if macro, ok := cronMacros[expression]; ok {
+		fields = strings.Fields(macro)
+	}
+	if len(fields) != 5 {
+		return nil, errors.Errorf("cron expression must have 5 fields: %s", expression)
+	}
+
+	c := &cron{expression: expression}
+	var err error
+	if c.minutes, _, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, errors.Wrapf(err, "invalid minute in cron expression: %s", expression)
+	}
+	if c.hours, _, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, errors.Wrapf(err, "invalid hour in cron expression: %s", expression)
+	}
+	if c.days, c.daysRestricted, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, errors.Wrapf(err, "invalid day of month in cron expression: %s", expression)
+	}
+	if c.months, _, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, errors.Wrapf(err, "invalid month in cron expression: %s", expression)
+	}
+	if c.weekdays, c.weekdaysRestricted, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, errors.Wrapf(err, "invalid day of week in cron expression: %s", expression)
+	}
+	// both 0 and 7 are sunday
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+
+	return c, nil
+}
+
+// parseCronField returns a bit set of the values matched by the field, along with whether the
+// field restricts the values at all
+func parseCronField(field string, min, max int) (uint64, bool, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, false, errors.Errorf("invalid step: %s", part)
+			}
+			rangePart = part[:i]
+		}
+
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, false, errors.Errorf("invalid range: %s", part)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, false, errors.Errorf("invalid value: %s", part)
+			}
+			start, end = value, value
+			// a single value with a step runs from the value to the maximum
+			if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, false, errors.Errorf("value out of range %d-%d: %s", min, max, part)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+
+	return bits, field != "*", nil
+}
+
+func (c *cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// every possible match is found within a few years, otherwise the expression never matches
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *cron) matchesDay(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	if c.daysRestricted && c.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+func (c *cron) String() string {
+	return c.expression
+}
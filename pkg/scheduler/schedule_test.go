@@ -0,0 +1,57 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/scheduler"
+)
+
+func TestCronScheduleFindsNextTime(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+	after := time.Date(2024, 1, 15, 9, 30, 0, 0, london) // a monday
+
+	for expression, expected := range map[string]time.Time{
+		"1 0 * * *":      time.Date(2024, 1, 16, 0, 1, 0, 0, london),
+		"*/15 * * * *":   time.Date(2024, 1, 15, 9, 45, 0, 0, london),
+		"0 9-17 * * 1-5": time.Date(2024, 1, 15, 10, 0, 0, 0, london),
+		"30 8 * * 6,7":   time.Date(2024, 1, 20, 8, 30, 0, 0, london),
+		"0 0 29 2 *":     time.Date(2024, 2, 29, 0, 0, 0, 0, london),
+		"0 0 1 * 5":      time.Date(2024, 1, 19, 0, 0, 0, 0, london),
+		"@monthly":       time.Date(2024, 2, 1, 0, 0, 0, 0, london),
+	} {
+		schedule, err := scheduler.ParseCron(expression)
+		require.NoError(t, err, expression)
+		require.Equal(t, expected, schedule.Next(after), expression)
+	}
+}
+
+func TestCronScheduleRejectsInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := scheduler.ParseCron(expression)
+		require.Error(t, err, expression)
+	}
+}
+
+func TestTriggeredJobsDoNotOverlap(t *testing.T) {
+	s := scheduler.New()
+	defer s.Shutdown()
+
+	release := make(chan struct{})
+	require.NoError(t, s.Register("job", scheduler.Every(time.Hour, 0), func() error {
+		<-release
+		return nil
+	}))
+	require.Error(t, s.Register("job", scheduler.Every(time.Hour, 0), func() error { return nil }))
+
+	require.True(t, s.Trigger("job"))
+	require.Eventually(t, func() bool { return s.GetJobs()[0].Running }, time.Second, 10*time.Millisecond)
+	require.False(t, s.Trigger("job"))
+	require.False(t, s.Trigger("missing"))
+
+	close(release)
+	require.Eventually(t, func() bool { return s.GetJobs()[0].Runs == 1 }, time.Second, 10*time.Millisecond)
+	require.False(t, s.GetJobs()[0].Running)
+}
@@ -3,72 +3,250 @@ package scheduler
 import (
 	"context"
 	"log/slog"
+	"sync"
 	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/model"
 )
 
+// Scheduler runs named jobs on their own schedules. A job never runs more than once at a time,
+// whether it was scheduled or triggered manually
 type Scheduler struct {
-	timeToExecute           time.Time
-	function                func()
-	currentContextCanceller context.CancelFunc
+	location *time.Location
+	jobs     []*job
+	lock     sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func New(timeToExecute time.Time, f func()) *Scheduler {
+type job struct {
+	name     string
+	schedule Schedule
+	function func() error
+	trigger  chan struct{}
+
+	lock         sync.Mutex
+	running      bool
+	runs         int
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	nextRun      time.Time
+}
+
+// Option defines the function used to set options
+type Option func(*Scheduler)
+
+// WithLocation specifies the time zone which schedules are evaluated in
+func WithLocation(location *time.Location) Option {
+	return func(s *Scheduler) {
+		s.location = location
+	}
+}
+
+// New creates a new scheduler without any jobs
+func New(opts ...Option) *Scheduler {
 	s := &Scheduler{
-		timeToExecute: timeToExecute,
-		function:      f,
+		location: time.Local,
+		jobs:     []*job{},
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(s)
 	}
 
-	s.reschedule()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	return s
 }
 
-func (s *Scheduler) Shutdown() {
-	slog.Info("scheduler shutting down")
-	s.cancelCurrentContext()
-}
+// Register adds a job which runs the given function on the given schedule. Every job must have
+// a unique name
+func (s *Scheduler) Register(name string, schedule Schedule, f func() error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, existing := range s.jobs {
+		if existing.name == name {
+			return errors.Errorf("job is already registered: %s", name)
+		}
+	}
 
-func (s *Scheduler) cancelCurrentContext() {
-	if s.currentContextCanceller != nil {
-		s.currentContextCanceller()
-		s.currentContextCanceller = nil
+	j := &job{
+		name:     name,
+		schedule: schedule,
+		function: f,
+		trigger:  make(chan struct{}, 1),
 	}
+	s.jobs = append(s.jobs, j)
+
+	s.wg.Add(1)
+	go s.loop(j)
+
+	return nil
 }
 
-func (s *Scheduler) calculateNextTime() time.Time {
-	now := time.Now()
+// Trigger runs the named job as soon as possible. False is returned if there is no such job or
+// it is already running
+func (s *Scheduler) Trigger(name string) bool {
+	j := s.findJob(name)
+	if j == nil {
+		return false
+	}
 
-	nextTime := time.Date(now.Year(), now.Month(), now.Day(), s.timeToExecute.Hour(), s.timeToExecute.Minute(), s.timeToExecute.Second(), 0, now.Location())
-	if nextTime.Before(now) {
-		nextTime = nextTime.Add(24 * time.Hour)
+	j.lock.Lock()
+	running := j.running
+	j.lock.Unlock()
+	if running {
+		return false
 	}
 
-	return nextTime
+	select {
+	case j.trigger <- struct{}{}:
+		return true
+	default:
+		// the job has already been triggered
+		return false
+	}
 }
 
-func (s *Scheduler) reschedule() {
-	slog.Info("rescheduling scheduler")
-	s.cancelCurrentContext()
+// GetJobs returns the status of every job, in the order they were registered
+func (s *Scheduler) GetJobs() []*model.Job {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	s.currentContextCanceller = cancel
+	jobs := make([]*model.Job, len(s.jobs))
+	for i, j := range s.jobs {
+		jobs[i] = j.status()
+	}
+	return jobs
+}
 
-	nextTime := s.calculateNextTime()
-	go s.runAtTime(ctx, nextTime)
+// Shutdown stops every job, waiting for any which are running to finish
+func (s *Scheduler) Shutdown() {
+	slog.Info("scheduler shutting down")
+	s.cancel()
+	s.wg.Wait()
 }
 
-func (s *Scheduler) runAtTime(ctx context.Context, t time.Time) {
-	slog.Info("task scheduled", "time", t)
+func (s *Scheduler) findJob(name string) *job {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, j := range s.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// loop runs the job every time it is due or triggered. Runs happen within the loop, so a job
+// can never overlap with itself
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
 
 	for {
+		next := j.schedule.Next(time.Now().In(s.location))
+		j.lock.Lock()
+		j.nextRun = next
+		j.lock.Unlock()
+
+		var due <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			slog.Debug("job scheduled", "job", j.name, "time", next)
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+
 		select {
-		case <-ctx.Done():
+		case <-s.ctx.Done():
+		case <-due:
+			s.run(j, false)
+		case <-j.trigger:
+			slog.Info("job triggered", "job", j.name)
+			s.run(j, true)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if s.ctx.Err() != nil {
 			return
-		case <-time.After(time.Until(t)):
-			slog.Info("running scheduled task")
-			s.function()
-			s.reschedule()
 		}
 	}
 }
 
+// run calls the job and records the outcome. Scheduled runs are only logged at debug level
+// unless they fail, whereas manually triggered runs are always logged
+func (s *Scheduler) run(j *job, triggered bool) {
+	j.lock.Lock()
+	j.running = true
+	j.lock.Unlock()
+
+	level := slog.LevelDebug
+	if triggered {
+		level = slog.LevelInfo
+	}
+
+	slog.Log(s.ctx, level, "running job", "job", j.name)
+	startTime := time.Now()
+	err := s.call(j)
+	duration := time.Since(startTime)
+
+	if err != nil {
+		slog.Error("job failed", "job", j.name, "duration", duration, "error", err)
+		sentry.CaptureException(errors.Wrapf(err, "job %s failed", j.name))
+	} else {
+		slog.Log(s.ctx, level, "job complete", "job", j.name, "duration", duration)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.running = false
+	j.runs++
+	j.lastRun = startTime
+	j.lastDuration = duration
+	j.lastError = ""
+	if err != nil {
+		j.lastError = err.Error()
+	}
+}
+
+// call runs the job's function, recovering from any panic so the job keeps running
+func (s *Scheduler) call(j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("job panicked: %v", r)
+		}
+	}()
+	return j.function()
+}
+
+func (j *job) status() *model.Job {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	status := &model.Job{
+		Name:         j.name,
+		Schedule:     j.schedule.String(),
+		Running:      j.running,
+		Runs:         j.runs,
+		LastDuration: j.lastDuration.Milliseconds(),
+		LastError:    j.lastError,
+	}
+	if !j.lastRun.IsZero() {
+		status.LastRunAt = j.lastRun.Unix()
+	}
+	if !j.nextRun.IsZero() {
+		status.NextRunAt = j.nextRun.Unix()
+	}
+	return status
+}
+
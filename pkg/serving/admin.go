@@ -0,0 +1,235 @@
+package serving
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// ContentManager defines the methods required to manage the live content revision
+type ContentManager interface {
+	GetContentRevisions() []*model.ContentRevision
+	Rollback(revision string) error
+}
+
+// Invalidations defines the methods required to manage failed cache invalidations
+type Invalidations interface {
+	GetDeadLetters() []*model.FailedInvalidation
+	RetryDeadLetters()
+}
+
+// Deliveries defines the methods required to inspect webhook deliveries
+type Deliveries interface {
+	GetDeliveries() []*model.Delivery
+}
+
+// Jobs defines the methods required to inspect and run scheduled jobs
+type Jobs interface {
+	GetJobs() []*model.Job
+	Trigger(name string) bool
+}
+
+func (s *Server) registerAdminRoutes(router *mux.Router) {
+	router.Use(s.adminAuthMiddleware)
+
+	if s.contentManager != nil {
+		router.HandleFunc("/content/revisions", s.listContentRevisions).Methods(http.MethodGet)
+		router.HandleFunc("/content/revisions/{revision}/rollback", s.rollbackContent).Methods(http.MethodPost)
+	}
+
+	if s.invalidations != nil {
+		router.HandleFunc("/invalidations/dead-letters", s.listDeadLetters).Methods(http.MethodGet)
+		router.HandleFunc("/invalidations/dead-letters/retry", s.retryDeadLetters).Methods(http.MethodPost)
+	}
+
+	if s.deliveries != nil {
+		router.HandleFunc("/webhooks/deliveries", s.listDeliveries).Methods(http.MethodGet)
+	}
+
+	if s.jobs != nil {
+		router.HandleFunc("/jobs", s.listJobs).Methods(http.MethodGet)
+		router.HandleFunc("/jobs/{job}/run", s.runJob).Methods(http.MethodPost)
+	}
+}
+
+func (s *Server) listContentRevisions(w http.ResponseWriter, r *http.Request) {
+	revisions := s.contentManager.GetContentRevisions()
+	revisionResponses := make([]ContentRevision, len(revisions))
+	for i, revision := range revisions {
+		revisionResponses[i] = convertContentRevision(revision)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListContentRevisionsResponse{revisionResponses})
+}
+
+func (s *Server) rollbackContent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var revision *model.ContentRevision
+	for _, available := range s.contentManager.GetContentRevisions() {
+		if available.ID == vars["revision"] && !available.Rejected {
+			revision = available
+		}
+	}
+	if revision == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	if err := s.contentManager.Rollback(revision.ID); err != nil {
+		Logger(r.Context()).Error("failed to roll back content", "revision", revision.ID, "error", err)
+		s.internalError(w, r)
+		return
+	}
+
+	s.listContentRevisions(w, r)
+}
+
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deadLetters := s.invalidations.GetDeadLetters()
+	deadLetterResponses := make([]FailedInvalidation, len(deadLetters))
+	for i, deadLetter := range deadLetters {
+		deadLetterResponses[i] = FailedInvalidation{
+			Target:   deadLetter.Target,
+			Path:     deadLetter.Path,
+			Attempts: deadLetter.Attempts,
+			Error:    deadLetter.Error,
+			FailedAt: deadLetter.FailedAt,
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListDeadLettersResponse{deadLetterResponses})
+}
+
+func (s *Server) retryDeadLetters(w http.ResponseWriter, r *http.Request) {
+	s.invalidations.RetryDeadLetters()
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ListDeadLettersResponse{[]FailedInvalidation{}})
+}
+
+func (s *Server) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	// deliveries can be filtered by their status: delivered, pending or failed
+	status := r.URL.Query().Get("status")
+
+	deliveryResponses := []Delivery{}
+	for _, delivery := range s.deliveries.GetDeliveries() {
+		response := convertDelivery(delivery)
+		if status != "" && response.Status != status {
+			continue
+		}
+		deliveryResponses = append(deliveryResponses, response)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListDeliveriesResponse{deliveryResponses})
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := s.jobs.GetJobs()
+	jobResponses := make([]Job, len(jobs))
+	for i, job := range jobs {
+		jobResponses[i] = convertJob(job)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListJobsResponse{jobResponses})
+}
+
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var job *model.Job
+	for _, available := range s.jobs.GetJobs() {
+		if available.Name == vars["job"] {
+			job = available
+		}
+	}
+	if job == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	if !s.jobs.Trigger(job.Name) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{"job is already running"})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(convertJob(job))
+}
+
+func (s *Server) unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(ErrorResponse{"unauthorized"})
+}
+
+func (s *Server) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			s.unauthorized(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func convertContentRevision(revision *model.ContentRevision) ContentRevision {
+	problems := revision.Problems
+	if problems == nil {
+		problems = []string{}
+	}
+
+	return ContentRevision{
+		ID:       revision.ID,
+		Source:   revision.Source,
+		StagedAt: revision.StagedAt,
+		Live:     revision.Live,
+		Rejected: revision.Rejected,
+		Problems: problems,
+	}
+}
+
+func convertDelivery(delivery *model.Delivery) Delivery {
+	status := "pending"
+	switch {
+	case delivery.Delivered:
+		status = "delivered"
+	case delivery.Failed:
+		status = "failed"
+	}
+
+	return Delivery{
+		ID:            delivery.ID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Webhook:       delivery.Webhook,
+		Status:        status,
+		Attempts:      delivery.Attempts,
+		StatusCode:    delivery.StatusCode,
+		Error:         delivery.Error,
+		CreatedAt:     delivery.CreatedAt,
+		LastAttemptAt: delivery.LastAttemptAt,
+	}
+}
+
+func convertJob(job *model.Job) Job {
+	return Job{
+		Name:           job.Name,
+		Schedule:       job.Schedule,
+		Running:        job.Running,
+		Runs:           job.Runs,
+		LastRunAt:      job.LastRunAt,
+		LastDurationMs: job.LastDuration,
+		LastError:      job.LastError,
+		NextRunAt:      job.NextRunAt,
+	}
+}
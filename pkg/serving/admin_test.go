@@ -0,0 +1,59 @@
+package serving_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/serving"
+)
+
+type stubContentManager struct{}
+
+func (stubContentManager) GetContentRevisions() []*model.ContentRevision {
+	return []*model.ContentRevision{{ID: "abc", Live: true}}
+}
+
+func (stubContentManager) Rollback(revision string) error { return nil }
+
+func TestAdminRoutesRequireTheToken(t *testing.T) {
+	s := newTestServer(&stubIndex{}, &stubMetrics{},
+		serving.WithAdminToken("secret"),
+		serving.WithContentManager(stubContentManager{}),
+	)
+
+	for name, tc := range map[string]struct {
+		authorization string
+		expected      int
+	}{
+		"no token":       {expected: http.StatusUnauthorized},
+		"wrong token":    {authorization: "Bearer wrong", expected: http.StatusUnauthorized},
+		"token prefix":   {authorization: "Bearer secre", expected: http.StatusUnauthorized},
+		"missing scheme": {authorization: "secret", expected: http.StatusUnauthorized},
+		"wrong scheme":   {authorization: "Basic secret", expected: http.StatusUnauthorized},
+		"correct token":  {authorization: "Bearer secret", expected: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/content/revisions", nil)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+			w := serve(s.Handler(), r)
+			require.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				require.JSONEq(t, `{"revisions":[{"id":"abc","source":"","stagedAt":0,"live":true,"rejected":false,"problems":[]}]}`, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminRoutesAreDisabledWithoutAToken(t *testing.T) {
+	s := newTestServer(&stubIndex{}, &stubMetrics{}, serving.WithContentManager(stubContentManager{}))
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/content/revisions", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	require.Equal(t, http.StatusNotFound, serve(s.Handler(), r).Code)
+}
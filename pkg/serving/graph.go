@@ -0,0 +1,67 @@
+package serving
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+func (s *Server) getGraph(w http.ResponseWriter, r *http.Request) {
+	response := GraphResponse{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	if graph := s.index.GetGraph(); graph != nil {
+		for _, node := range graph.Nodes {
+			response.Nodes = append(response.Nodes, s.convertGraphNode(node))
+		}
+		for _, edge := range graph.Edges {
+			response.Edges = append(response.Edges, GraphEdge{edge.Source, edge.Target, edge.Type})
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// backlinks converts the published articles which link to the given article, newest first
+func (s *Server) backlinks(r *http.Request, article *model.Article) []Article {
+	linking := []*model.Article{}
+	for _, backlink := range s.index.GetBacklinks(article.FilePath) {
+		if backlink.IsPublished() {
+			linking = append(linking, backlink)
+		}
+	}
+	sort.SliceStable(linking, func(x, y int) bool {
+		return linking[x].PublishedAt > linking[y].PublishedAt
+	})
+
+	backlinks := []Article{}
+	for _, backlink := range linking {
+		topic := s.index.GetTopicByIdentifier(backlink.TopicSlug)
+		if topic == nil {
+			Logger(r.Context()).Error("failed to find topic for article", "article", backlink.Slug)
+			continue
+		}
+		if topic.IsExpired() {
+			continue
+		}
+		backlinks = append(backlinks, s.convertArticle(topic, backlink))
+	}
+	return backlinks
+}
+
+func (s *Server) convertGraphNode(node *model.GraphNode) GraphNode {
+	url := fmt.Sprintf("%s/topics/%s", s.pathPrefix, node.Slug)
+	if node.Type == model.GraphNodeArticle {
+		url = fmt.Sprintf("%s/topics/%s/articles/%s", s.pathPrefix, node.TopicSlug, node.Slug)
+	}
+
+	return GraphNode{
+		ID:        node.ID,
+		Type:      node.Type,
+		Title:     node.Title,
+		URL:       url,
+		TopicSlug: node.TopicSlug,
+	}
+}
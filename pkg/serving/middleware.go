@@ -0,0 +1,249 @@
+package serving
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader holds the ID of the request, which is generated if the caller does not
+// provide one and is returned with every response
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	// AccessLogStructured logs every request with the structured logger
+	AccessLogStructured = "structured"
+	// AccessLogCombined writes every request in the Combined Log Format
+	AccessLogCombined = "combined"
+)
+
+// requestIDPattern matches the request IDs which are accepted from callers
+var requestIDPattern = regexp.MustCompile(`^[\w\-.:]{1,128}$`)
+
+type loggerKey struct{}
+
+// Logger returns the logger for the request, which includes the request ID
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// requestIDMiddleware assigns every request an ID, using the caller's ID if it is valid, and
+// attaches it to the request's logger
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := withLogger(r.Context(), Logger(r.Context()).With("request_id", requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// accessLogMiddleware logs every request once it has been served
+func (s *Server) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if s.accessLogFormat == AccessLogCombined {
+			fmt.Fprintln(s.accessLogWriter, combinedLogLine(r, s.visitorAddress(r), recorder, startTime))
+			return
+		}
+		Logger(r.Context()).Info("request",
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", time.Since(startTime).Milliseconds(),
+			"remote", s.visitorAddress(r),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// combinedLogLine formats the request in the Combined Log Format
+func combinedLogLine(r *http.Request, remote string, recorder *responseRecorder, startTime time.Time) string {
+	bytes := "-"
+	if recorder.bytes > 0 {
+		bytes = fmt.Sprint(recorder.bytes)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s "%s" "%s"`,
+		remote,
+		startTime.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.RequestURI, r.Proto,
+		recorder.status,
+		bytes,
+		orDash(r.Referer()),
+		orDash(r.UserAgent()),
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// recoveryMiddleware recovers from panics in handlers, reporting them to Sentry and responding
+// with an internal error if nothing has been written yet
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// an aborted handler is expected to stop the response without being reported
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			Logger(r.Context()).Error("recovered from panic", "method", r.Method, "uri", r.RequestURI, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+
+			hub := sentry.CurrentHub().Clone()
+			hub.Scope().SetRequest(r)
+			hub.Scope().SetTag("request_id", recorder.Header().Get(RequestIDHeader))
+			hub.Scope().SetTag("route", routeTemplate(r))
+			hub.RecoverWithContext(r.Context(), recovered)
+
+			if recorder.wroteHeader {
+				return
+			}
+			recorder.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(recorder).Encode(ErrorResponse{"internal error"})
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+type routeKey struct{}
+
+// recordingMiddleware records every request, including those which match no route. It wraps the
+// router, so the matched route is passed back out by routeMiddleware
+func (s *Server) recordingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		route := "unknown"
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+
+		s.metrics.Request(route, r.Method, recorder.status, recorder.bytes, startTime)
+	})
+}
+
+// routeMiddleware passes the template of the matched route out to recordingMiddleware
+func routeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = routeTemplate(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tracingMiddleware starts a span for every request, continuing any trace given in the W3C
+// trace context headers
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeTemplate(r)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		// include the trace in any logs so they can be found from the trace
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			ctx = withLogger(ctx, Logger(ctx).With("trace_id", spanContext.TraceID().String()))
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status), semconv.HTTPResponseBodySize(int(recorder.bytes)))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// routeVariablePatternRegex matches the patterns of route variables, such as {topic:.+}
+var routeVariablePatternRegex = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// routeTemplate returns the template of the route which matched the request without any
+// variable patterns, such as /topics/{topic}
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return routeVariablePatternRegex.ReplaceAllString(template, "{$1}")
+		}
+	}
+	return "unknown"
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// responseRecorder records the status code and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
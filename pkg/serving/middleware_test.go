@@ -0,0 +1,144 @@
+package serving_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/metrics"
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/serving"
+)
+
+// newPanickingIndex returns an index with articles which make the stub reader panic
+func newPanickingIndex() *stubIndex {
+	published := time.Now().Add(-time.Hour).Unix()
+	return &stubIndex{
+		topics: []*model.Topic{{Slug: "go", FilePath: "go/README.md", PublishedAt: published}},
+		articles: []*model.Article{
+			{Slug: "panic", TopicSlug: "go", FilePath: "panic.md", PublishedAt: published},
+			{Slug: "abort", TopicSlug: "go", FilePath: "abort.md", PublishedAt: published},
+		},
+	}
+}
+
+func TestAssignsRequestIDs(t *testing.T) {
+	s := newTestServer(&stubIndex{}, &stubMetrics{})
+
+	for name, tc := range map[string]struct {
+		requestID string
+		expected  string
+	}{
+		"valid ID":     {"client-id_1.2:3", "client-id_1.2:3"},
+		"no ID":        {"", ""},
+		"malformed ID": {"not a valid id", ""},
+		"injected ID":  {"id\nforged=true", ""},
+		"oversized ID": {string(bytes.Repeat([]byte("a"), 129)), ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/status", nil)
+			if tc.requestID != "" {
+				r.Header.Set(serving.RequestIDHeader, tc.requestID)
+			}
+			w := serve(s.Handler(), r)
+
+			requestID := w.Header().Get(serving.RequestIDHeader)
+			if tc.expected != "" {
+				require.Equal(t, tc.expected, requestID)
+				return
+			}
+			require.Regexp(t, `^[0-9a-f]{32}$`, requestID)
+		})
+	}
+
+	// requests which match no route are given an ID too
+	w := serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Regexp(t, `^[0-9a-f]{32}$`, w.Header().Get(serving.RequestIDHeader))
+}
+
+func TestWritesCombinedAccessLogs(t *testing.T) {
+	log := &bytes.Buffer{}
+	s := newTestServer(&stubIndex{}, &stubMetrics{}, serving.WithAccessLog(serving.AccessLogCombined, log))
+
+	r := httptest.NewRequest(http.MethodGet, "/topics?sort=new", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	r.Header.Set("Referer", "https://blog.example.com/")
+	r.Header.Set("User-Agent", "test-agent/1.0")
+	w := serve(s.Handler(), r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	pattern := regexp.MustCompile(`^203\.0\.113\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /topics\?sort=new HTTP/1\.1" 200 (\d+) "https://blog\.example\.com/" "test-agent/1\.0"\n$`)
+	matches := pattern.FindStringSubmatch(log.String())
+	require.NotNil(t, matches, log.String())
+	require.Equal(t, strconv.Itoa(w.Body.Len()), matches[1])
+
+	// missing fields are written as dashes
+	log.Reset()
+	r = httptest.NewRequest(http.MethodHead, "/missing", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	serve(s.Handler(), r)
+	require.Regexp(t, `^203\.0\.113\.7 - - \[[^]]+\] "HEAD /missing HTTP/1\.1" 404 \d+ "-" "-"\n$`, log.String())
+}
+
+func TestRecoversFromPanics(t *testing.T) {
+	s := newTestServer(newPanickingIndex(), &stubMetrics{})
+
+	r := httptest.NewRequest(http.MethodGet, "/topics/go/articles/panic", nil)
+	r.Header.Set(serving.RequestIDHeader, "panicking-request")
+	w := serve(s.Handler(), r)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.JSONEq(t, `{"message": "internal error"}`, w.Body.String())
+	require.Equal(t, "panicking-request", w.Header().Get(serving.RequestIDHeader))
+}
+
+func TestRepanicsAbortedHandlers(t *testing.T) {
+	s := newTestServer(newPanickingIndex(), &stubMetrics{})
+
+	r := httptest.NewRequest(http.MethodGet, "/topics/go/articles/abort", nil)
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		serve(s.Handler(), r)
+	})
+}
+
+func TestRecordsEveryRequest(t *testing.T) {
+	index := newPanickingIndex()
+	index.topics = append(index.topics, &model.Topic{Slug: "go/testing", ParentSlug: "go", PublishedAt: index.topics[0].PublishedAt})
+	recorded := &stubMetrics{}
+	s := newTestServer(index, recorded)
+
+	for _, path := range []string{"/topics/go/testing", "/topics/go/testing/articles/missing", "/missing", "/topics/go/articles/panic"} {
+		serve(s.Handler(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// route variable patterns are removed from the recorded routes
+	require.Equal(t, []recordedRequest{
+		{"/topics/{topic}", http.StatusOK},
+		{"/topics/{topic}/articles/{article}", http.StatusNotFound},
+		{"unknown", http.StatusNotFound},
+		{"/topics/{topic}/articles/{article}", http.StatusInternalServerError},
+	}, recorded.requests)
+}
+
+func TestRecordsTheStatusClassOfRequests(t *testing.T) {
+	client := metrics.New(metrics.NewPrometheusBackend("blog"))
+	s := serving.New(stubReader{}, &stubIndex{}, "", "assets", "README.md", client,
+		serving.WithAccessLog(serving.AccessLogStructured, io.Discard))
+
+	serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/topics", nil))
+	serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/topics/go", nil))
+	serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	w := serve(client.Handler(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, w.Body.String(), `blog_request_total{method="GET",route="/topics",status_class="2xx"} 1`)
+	require.Contains(t, w.Body.String(), `blog_request_total{method="GET",route="/topics/{topic}",status_class="4xx"} 1`)
+	require.Contains(t, w.Body.String(), `blog_request_total{method="GET",route="unknown",status_class="4xx"} 1`)
+}
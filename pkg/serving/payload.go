@@ -12,30 +12,77 @@ type CommonItemResponse struct {
 	URL         string            `json:"url"`
 	Priority    int64             `json:"priority"`
 	Slug        string            `json:"slug"`
+	Source      string            `json:"source"`
 	PublishedAt int64             `json:"publishedAt"`
 	UpdatedAt   int64             `json:"updatedAt"`
+	ExpiresAt   int64             `json:"expiresAt"`
 	Hidden      bool              `json:"hidden"`
 	Metadata    map[string]string `json:"metadata"`
 }
 
+// TopicLink defines a link to a topic, such as a breadcrumb or a subtopic
+type TopicLink struct {
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+	URL   string `json:"url"`
+}
+
 type HtmlResponse struct {
 	Html string `json:"html"`
 }
 
 type Article struct {
 	CommonItemResponse
-	TopicSlug string `json:"topicSlug"`
+	TopicSlug string   `json:"topicSlug"`
+	Tags      []string `json:"tags"`
+	// Views is how many times the article has been viewed, which is 0 if views are not counted
+	Views int `json:"views"`
+	// Breadcrumbs are the topics the article is within, from the top level topic down
+	Breadcrumbs []TopicLink `json:"breadcrumbs"`
 }
 
 type GetArticleResponse struct {
 	Article
 	HtmlResponse
+	Related []Article `json:"related"`
+	// Backlinks are the published articles which link to the article
+	Backlinks []Article `json:"backlinks"`
+	// Previous and Next are the published articles either side of the article within its topic
+	Previous *Article `json:"previous"`
+	Next     *Article `json:"next"`
+	// Series is the series the article belongs to, if any
+	Series *ArticleSeries `json:"series"`
+}
+
+type Revision struct {
+	SHA     string `json:"sha"`
+	Date    int64  `json:"date"`
+	Author  string `json:"author"`
+	Message string `json:"message"`
+}
+
+type ListRevisionsResponse struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+type GetRevisionResponse struct {
+	Article
+	Revision Revision `json:"revision"`
+	HtmlResponse
+	Diff string `json:"diff"`
 }
 
 type Topic struct {
 	CommonItemResponse
 	ArticleURL            string `json:"articleUrl"`
 	PublishedArticleCount int    `json:"publishedArticleCount"`
+	// TotalPublishedArticleCount includes the published articles of every nested topic
+	TotalPublishedArticleCount int    `json:"totalPublishedArticleCount"`
+	ParentSlug                 string `json:"parentSlug"`
+	// Children are the topics nested directly within the topic
+	Children []TopicLink `json:"children"`
+	// Breadcrumbs are the topics from the top level topic down to the topic itself
+	Breadcrumbs []TopicLink `json:"breadcrumbs"`
 }
 
 type OverviewResponse struct {
@@ -55,6 +102,116 @@ type ListArticlesResponse struct {
 	Articles []Article `json:"articles"`
 }
 
+type Series struct {
+	Title        string `json:"title"`
+	Slug         string `json:"slug"`
+	URL          string `json:"url"`
+	ArticleCount int    `json:"articleCount"`
+}
+
+type ArticleSeries struct {
+	Series
+	// Position is where the article comes in the series, starting from 1
+	Position int `json:"position"`
+}
+
+type ListSeriesResponse struct {
+	Series []Series `json:"series"`
+}
+
+type GetSeriesResponse struct {
+	Series
+	Articles []Article `json:"articles"`
+}
+
+type GraphNode struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// TopicSlug is the topic of an article node, empty for topic nodes
+	TopicSlug string `json:"topicSlug"`
+}
+
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+type GraphResponse struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type PopularArticle struct {
+	Article
+	// WindowViews is how many times the article was viewed within the window
+	WindowViews int `json:"windowViews"`
+}
+
+type ListPopularResponse struct {
+	Window   string           `json:"window"`
+	Articles []PopularArticle `json:"articles"`
+}
+
+type ContentRevision struct {
+	ID       string   `json:"id"`
+	Source   string   `json:"source"`
+	StagedAt int64    `json:"stagedAt"`
+	Live     bool     `json:"live"`
+	Rejected bool     `json:"rejected"`
+	Problems []string `json:"problems"`
+}
+
+type ListContentRevisionsResponse struct {
+	Revisions []ContentRevision `json:"revisions"`
+}
+
+type FailedInvalidation struct {
+	Target   string `json:"target"`
+	Path     string `json:"path"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+	FailedAt int64  `json:"failedAt"`
+}
+
+type ListDeadLettersResponse struct {
+	DeadLetters []FailedInvalidation `json:"deadLetters"`
+}
+
+type Delivery struct {
+	ID            string `json:"id"`
+	EventID       string `json:"eventId"`
+	EventType     string `json:"eventType"`
+	Webhook       string `json:"webhook"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	StatusCode    int    `json:"statusCode"`
+	Error         string `json:"error"`
+	CreatedAt     int64  `json:"createdAt"`
+	LastAttemptAt int64  `json:"lastAttemptAt"`
+}
+
+type ListDeliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+type Job struct {
+	Name           string `json:"name"`
+	Schedule       string `json:"schedule"`
+	Running        bool   `json:"running"`
+	Runs           int    `json:"runs"`
+	LastRunAt      int64  `json:"lastRunAt"`
+	LastDurationMs int64  `json:"lastDurationMs"`
+	LastError      string `json:"lastError"`
+	NextRunAt      int64  `json:"nextRunAt"`
+}
+
+type ListJobsResponse struct {
+	Jobs []Job `json:"jobs"`
+}
+
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
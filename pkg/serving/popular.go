@@ -0,0 +1,125 @@
+package serving
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// maxPopularLimit is the most popular articles which can be requested at once
+const maxPopularLimit = 50
+
+// Views defines the methods required to count views of articles
+type Views interface {
+	Record(topicSlug, articleSlug, visitor, userAgent string)
+	GetViews(topicSlug, articleSlug string) int
+	GetPopular(window time.Duration, limit int) []*model.ArticleViews
+}
+
+func (s *Server) getPopular(w http.ResponseWriter, r *http.Request) {
+	windowParam := r.URL.Query().Get("window")
+	if windowParam == "" {
+		windowParam = "7d"
+	}
+	window, err := parseWindow(windowParam)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{"invalid window, expected a duration such as 7d or 12h"})
+		return
+	}
+
+	limit := 5
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{"invalid limit, expected a positive number"})
+			return
+		}
+	}
+	limit = min(limit, maxPopularLimit)
+
+	// every viewed article is fetched, by not limiting them, as some may no longer be published
+	articles := []PopularArticle{}
+	for _, views := range s.views.GetPopular(window, 0) {
+		if len(articles) >= limit {
+			break
+		}
+		topic := s.index.GetTopicByIdentifier(views.TopicSlug)
+		article := s.index.GetArticleByIdentifier(views.TopicSlug, views.ArticleSlug)
+		if topic == nil || article == nil || topic.IsExpired() || !article.IsPublished() || article.Hidden {
+			continue
+		}
+		articles = append(articles, PopularArticle{s.convertArticle(topic, article), views.Views})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListPopularResponse{windowParam, articles})
+}
+
+// parseWindow parses a duration which may also be given in days, such as 7d
+func parseWindow(window string) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(window, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(window)
+	}
+	if err == nil && duration <= 0 {
+		err = strconv.ErrRange
+	}
+	return duration, err
+}
+
+// visitorAddress returns the address of the visitor. The address forwarded by a proxy, such as
+// the blog site, is only used when the request comes from a trusted proxy, as anyone else
+// could set it to anything
+func (s *Server) visitorAddress(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remote = host
+	}
+	if !s.isTrustedProxy(remote) {
+		return remote
+	}
+
+	// each proxy appends the address it received the request from, so the visitor is the
+	// last address which was not added by a trusted proxy
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+			if i == 0 || !s.isTrustedProxy(address) {
+				return address
+			}
+		}
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	return remote
+}
+
+// isTrustedProxy returns true if the given address is one of the trusted proxies
+func (s *Server) isTrustedProxy(address string) bool {
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, proxy := range s.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package serving_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/serving"
+)
+
+// stubViews records the visitor of every view and returns every article as popular
+type stubViews struct {
+	popular  []*model.ArticleViews
+	visitors []string
+}
+
+func (v *stubViews) Record(topicSlug, articleSlug, visitor, userAgent string) {
+	v.visitors = append(v.visitors, visitor)
+}
+
+func (v *stubViews) GetViews(topicSlug, articleSlug string) int { return 0 }
+
+func (v *stubViews) GetPopular(window time.Duration, limit int) []*model.ArticleViews {
+	return v.popular
+}
+
+func TestLimitsPopularArticles(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	index := &stubIndex{topics: []*model.Topic{{Slug: "go", PublishedAt: published}}}
+	views := &stubViews{}
+	for i := 0; i < 60; i++ {
+		slug := fmt.Sprintf("article-%d", i)
+		index.articles = append(index.articles, &model.Article{Slug: slug, TopicSlug: "go", PublishedAt: published})
+		views.popular = append(views.popular, &model.ArticleViews{TopicSlug: "go", ArticleSlug: slug, Views: 60 - i})
+	}
+	s := newTestServer(index, &stubMetrics{}, serving.WithViews(views))
+
+	for query, tc := range map[string]struct {
+		status   int
+		expected int
+	}{
+		"":             {http.StatusOK, 5},
+		"?limit=2":     {http.StatusOK, 2},
+		"?limit=0":     {http.StatusBadRequest, 0},
+		"?limit=1000":  {http.StatusOK, 50},
+		"?limit=-1":    {http.StatusBadRequest, 0},
+		"?limit=many":  {http.StatusBadRequest, 0},
+		"?window=soon": {http.StatusBadRequest, 0},
+	} {
+		t.Run(query, func(t *testing.T) {
+			w := serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/popular"+query, nil))
+			require.Equal(t, tc.status, w.Code)
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var response serving.ListPopularResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Articles, tc.expected)
+		})
+	}
+}
+
+func TestOnlyTrustsForwardedAddressesFromTrustedProxies(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	index := &stubIndex{
+		topics:   []*model.Topic{{Slug: "go", PublishedAt: published}},
+		articles: []*model.Article{{Slug: "intro", TopicSlug: "go", PublishedAt: published}},
+	}
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+
+	for name, tc := range map[string]struct {
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		"direct visitor":               {"203.0.113.7:1234", nil, "203.0.113.7"},
+		"forged forwarded address":     {"203.0.113.7:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		"forged real address":          {"203.0.113.7:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		"trusted proxy":                {"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		"trusted proxy real address":   {"192.0.2.1:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		"chain of trusted proxies":     {"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.4.5.6"}, "198.51.100.1"},
+		"forged address behind proxy":  {"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "192.0.2.55, 198.51.100.1"}, "198.51.100.1"},
+		"trusted proxy without header": {"10.1.2.3:1234", nil, "10.1.2.3"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			views := &stubViews{}
+			s := newTestServer(index, &stubMetrics{}, serving.WithViews(views), serving.WithTrustedProxies(trusted))
+
+			r := httptest.NewRequest(http.MethodGet, "/topics/go/articles/intro", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for header, value := range tc.headers {
+				r.Header.Set(header, value)
+			}
+			require.Equal(t, http.StatusOK, serve(s.Handler(), r).Code)
+			require.Equal(t, []string{tc.expected}, views.visitors)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package serving
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wamphlett/blog-server/pkg/diffing"
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	topic := s.index.GetTopicByIdentifier(vars["topic"])
+	if topic == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	article := s.index.GetArticleByIdentifier(vars["topic"], vars["article"])
+	if article == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	if topic.IsExpired() || article.IsExpired() {
+		s.expired(w, r)
+		return
+	}
+
+	revisions, err := s.history.GetFileRevisions(article.FilePath)
+	if err != nil {
+		Logger(r.Context()).Error("failed to read article revisions", "topic", vars["topic"], "article", vars["article"], "error", err)
+		s.internalError(w, r)
+		return
+	}
+	if revisions == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	revisionResponses := make([]Revision, len(revisions))
+	for i, revision := range revisions {
+		revisionResponses[i] = convertRevision(revision)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListRevisionsResponse{revisionResponses})
+}
+
+func (s *Server) getRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	topic := s.index.GetTopicByIdentifier(vars["topic"])
+	if topic == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	article := s.index.GetArticleByIdentifier(vars["topic"], vars["article"])
+	if article == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	if topic.IsExpired() || article.IsExpired() {
+		s.expired(w, r)
+		return
+	}
+
+	revision, previousContents, err := s.history.GetFileAtRevision(article.FilePath, vars["sha"])
+	if err != nil {
+		Logger(r.Context()).Error("failed to read article revision", "topic", vars["topic"], "article", vars["article"], "sha", vars["sha"], "error", err)
+		s.internalError(w, r)
+		return
+	}
+	if revision == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	currentContents, err := os.ReadFile(article.FilePath)
+	if err != nil {
+		Logger(r.Context()).Error("failed to read article file", "topic", vars["topic"], "article", vars["article"], "error", err)
+		s.internalError(w, r)
+		return
+	}
+
+	content, err := s.reader.RenderHTML(r.Context(), previousContents, article.FilePath)
+	if err != nil {
+		Logger(r.Context()).Error("failed to render article revision", "topic", vars["topic"], "article", vars["article"], "sha", vars["sha"], "error", err)
+		s.internalError(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GetRevisionResponse{
+		s.convertArticle(topic, article),
+		convertRevision(revision),
+		HtmlResponse{content},
+		diffing.Unified(string(previousContents), string(currentContents), revision.SHA, "current"),
+	})
+}
+
+func convertRevision(revision *model.Revision) Revision {
+	return Revision{
+		SHA:     revision.SHA,
+		Date:    revision.Date,
+		Author:  revision.Author,
+		Message: revision.Message,
+	}
+}
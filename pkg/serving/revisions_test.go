@@ -0,0 +1,92 @@
+package serving_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/serving"
+)
+
+// stubHistory holds the revisions of a single file along with its contents at each revision
+type stubHistory struct {
+	filePath  string
+	revisions []*model.Revision
+	contents  map[string]string
+}
+
+func (h *stubHistory) GetFileRevisions(filePath string) ([]*model.Revision, error) {
+	if filePath != h.filePath {
+		return nil, nil
+	}
+	return h.revisions, nil
+}
+
+func (h *stubHistory) GetFileAtRevision(filePath, sha string) (*model.Revision, []byte, error) {
+	if filePath != h.filePath {
+		return nil, nil, nil
+	}
+	for _, revision := range h.revisions {
+		if revision.SHA == sha {
+			return revision, []byte(h.contents[sha]), nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func TestServesArticleRevisions(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "intro.md")
+	require.NoError(t, os.WriteFile(filePath, []byte("# Intro\nupdated\n"), 0o644))
+
+	published := time.Now().Add(-time.Hour).Unix()
+	index := &stubIndex{
+		topics: []*model.Topic{{Slug: "go", PublishedAt: published}},
+		articles: []*model.Article{
+			{Slug: "intro", TopicSlug: "go", FilePath: filePath, PublishedAt: published},
+			{Slug: "untracked", TopicSlug: "go", FilePath: "untracked.md", PublishedAt: published},
+		},
+	}
+	history := &stubHistory{
+		filePath: filePath,
+		revisions: []*model.Revision{
+			{SHA: "b2c3d4e", Author: "Author", Message: "update intro", Date: published},
+			{SHA: "a1b2c3d", Author: "Author", Message: "add intro", Date: published - 60},
+		},
+		contents: map[string]string{"a1b2c3d": "# Intro\noriginal\n"},
+	}
+	s := newTestServer(index, &stubMetrics{}, serving.WithHistory(history))
+
+	for path, tc := range map[string]struct {
+		status   int
+		expected string
+	}{
+		"/topics/go/articles/intro/revisions": {http.StatusOK, `{"revisions": [
+			{"sha": "b2c3d4e", "author": "Author", "message": "update intro"},
+			{"sha": "a1b2c3d", "author": "Author", "message": "add intro"}
+		]}`},
+		"/topics/go/articles/intro/revisions/a1b2c3d": {http.StatusOK, `{
+			"slug": "intro",
+			"revision": {"sha": "a1b2c3d", "message": "add intro"},
+			"html": "# Intro\noriginal\n",
+			"diff": "--- a1b2c3d\n+++ current\n@@ -1,2 +1,2 @@\n # Intro\n-original\n+updated\n"
+		}`},
+		"/topics/go/articles/intro/revisions/f0f0f0f":   {http.StatusNotFound, ""},
+		"/topics/go/articles/intro/revisions/not-a-sha": {http.StatusNotFound, ""},
+		"/topics/go/articles/untracked/revisions":       {http.StatusNotFound, ""},
+		"/topics/go/articles/missing/revisions":         {http.StatusNotFound, ""},
+	} {
+		t.Run(path, func(t *testing.T) {
+			w := serve(s.Handler(), httptest.NewRequest(http.MethodGet, path, nil))
+			require.Equal(t, tc.status, w.Code)
+			if tc.expected != "" {
+				requireJSONSubset(t, tc.expected, w.Body.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package serving
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+func (s *Server) listSeries(w http.ResponseWriter, r *http.Request) {
+	series := []Series{}
+	for _, item := range s.index.GetAllSeries() {
+		series = append(series, s.convertSeries(item))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListSeriesResponse{series})
+}
+
+func (s *Server) getSeries(w http.ResponseWriter, r *http.Request) {
+	series := s.index.GetSeriesByIdentifier(mux.Vars(r)["series"])
+	if series == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	articles := []Article{}
+	for _, article := range series.Articles {
+		topic := s.index.GetTopicByIdentifier(article.TopicSlug)
+		if topic == nil {
+			Logger(r.Context()).Error("failed to find topic for article", "article", article.Slug)
+			continue
+		}
+		articles = append(articles, s.convertArticle(topic, article))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GetSeriesResponse{s.convertSeries(series), articles})
+}
+
+// articleSeries returns the series the article belongs to along with its position, nil if the
+// article is not in a published series
+func (s *Server) articleSeries(article *model.Article) *ArticleSeries {
+	series := s.index.GetSeriesByIdentifier(article.SeriesSlug())
+	if series == nil {
+		return nil
+	}
+
+	for position, seriesArticle := range series.Articles {
+		if seriesArticle == article {
+			return &ArticleSeries{s.convertSeries(series), position + 1}
+		}
+	}
+	return nil
+}
+
+func (s *Server) buildSeriesUrl(series *model.Series) string {
+	return fmt.Sprintf("%s/series/%s", s.pathPrefix, series.Slug)
+}
+
+func (s *Server) convertSeries(series *model.Series) Series {
+	return Series{
+		Title:        series.Title,
+		Slug:         series.Slug,
+		URL:          s.buildSeriesUrl(series),
+		ArticleCount: len(series.Articles),
+	}
+}
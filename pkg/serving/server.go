@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -15,19 +17,30 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/otel"
 	"log/slog"
 
 	"github.com/wamphlett/blog-server/pkg/model"
 )
 
+var tracer = otel.Tracer("github.com/wamphlett/blog-server/pkg/serving")
+
 // Metrics defines the metrics used by the server
 type Metrics interface {
-	Request(uri string, startTime time.Time)
+	Request(route, method string, status int, bytes int64, startTime time.Time)
+	ContentViewed(topic, article string)
 }
 
 // FileReader defines the methods required by the reader
 type FileReader interface {
-	ReadFileAsHTML(filepath string) (string, error)
+	ReadFileAsHTML(ctx context.Context, filepath string) (string, error)
+	RenderHTML(ctx context.Context, contents []byte, filepath string) (string, error)
+}
+
+// History defines the methods required to look up previous revisions of content files
+type History interface {
+	GetFileRevisions(filePath string) ([]*model.Revision, error)
+	GetFileAtRevision(filePath, sha string) (*model.Revision, []byte, error)
 }
 
 // Index defines the methods required by the index
@@ -38,18 +51,41 @@ type Index interface {
 	GetArticleByIdentifier(topicIdentidier, identifier string) *model.Article
 	GetAllArticlesForTopic(topicIdentifier string) []*model.Article
 	GetRecentArticles(limit int) []*model.Article
+	GetRelatedArticles(topicIdentifier, identifier string) []*model.Article
+	GetAdjacentArticles(topicIdentifier, identifier string) (previous, next *model.Article)
+	GetAllSeries() []*model.Series
+	GetSeriesByIdentifier(identifier string) *model.Series
+	GetBacklinks(filepath string) []*model.Article
+	GetGraph() *model.Graph
+	GetPublishedArticleCount(topicIdentifier string) int
 }
 
 // Server defines a new server
 type Server struct {
 	reader           FileReader
 	index            Index
+	history          History
+	contentManager   ContentManager
+	invalidations    Invalidations
+	deliveries       Deliveries
+	jobs             Jobs
+	metricsHandler   http.Handler
+	goneForExpired   bool
+	countViews       bool
+	views            Views
+	accessLogFormat  string
+	accessLogWriter  io.Writer
+	adminToken       string
+	trustedProxies   []netip.Prefix
+	pathPrefix       string
 	srv              *http.Server
+	handler          http.Handler
 	router           *mux.Router
 	overviewFilePath string
 	metrics          Metrics
 	port             int
 	allowedOrigins   []string
+	contentDirs      contentDirs
 }
 
 // Option defines the function required to set options
@@ -69,6 +105,111 @@ func WithAllowedOrigins(origins []string) Option {
 	}
 }
 
+// WithHistory enables the article revision endpoints using the given history
+func WithHistory(history History) Option {
+	return func(s *Server) {
+		s.history = history
+	}
+}
+
+// WithAdditionalContentDirs specifies further content directories to serve static files from
+// when they are not found in the main content directory
+func WithAdditionalContentDirs(dirs ...string) Option {
+	return func(s *Server) {
+		for _, dir := range dirs {
+			s.contentDirs = append(s.contentDirs, http.Dir(dir))
+		}
+	}
+}
+
+// WithAdminToken enables the admin endpoints, which require the given token as a bearer token
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithTrustedProxies specifies the proxies whose forwarded visitor addresses are used
+func WithTrustedProxies(proxies []netip.Prefix) Option {
+	return func(s *Server) {
+		s.trustedProxies = proxies
+	}
+}
+
+// WithPathPrefix specifies the path prefix the server is hosted under, which is added to
+// every URL in its responses
+func WithPathPrefix(prefix string) Option {
+	return func(s *Server) {
+		s.pathPrefix = strings.TrimRight(prefix, "/")
+	}
+}
+
+// WithContentManager enables the admin endpoints used to manage content revisions
+func WithContentManager(contentManager ContentManager) Option {
+	return func(s *Server) {
+		s.contentManager = contentManager
+	}
+}
+
+// WithInvalidations enables the admin endpoints used to inspect failed cache invalidations
+func WithInvalidations(invalidations Invalidations) Option {
+	return func(s *Server) {
+		s.invalidations = invalidations
+	}
+}
+
+// WithDeliveries enables the admin endpoints used to inspect webhook deliveries
+func WithDeliveries(deliveries Deliveries) Option {
+	return func(s *Server) {
+		s.deliveries = deliveries
+	}
+}
+
+// WithJobs enables the admin endpoints used to inspect and run scheduled jobs
+func WithJobs(jobs Jobs) Option {
+	return func(s *Server) {
+		s.jobs = jobs
+	}
+}
+
+// WithMetricsHandler serves the given handler on /metrics for metrics to be scraped
+func WithMetricsHandler(handler http.Handler) Option {
+	return func(s *Server) {
+		s.metricsHandler = handler
+	}
+}
+
+// WithGoneForExpired returns 410 Gone rather than 404 Not Found for expired topics and articles
+func WithGoneForExpired() Option {
+	return func(s *Server) {
+		s.goneForExpired = true
+	}
+}
+
+// WithContentViewMetrics records a metric for every successful view of a topic or article
+func WithContentViewMetrics() Option {
+	return func(s *Server) {
+		s.countViews = true
+	}
+}
+
+// WithViews counts views of articles, which are included with every article and used to list
+// the most popular articles
+func WithViews(views Views) Option {
+	return func(s *Server) {
+		s.views = views
+	}
+}
+
+// WithAccessLog specifies the format of the access log, either structured or combined, along
+// with where combined logs are written
+func WithAccessLog(format string, writer io.Writer) Option {
+	return func(s *Server) {
+		s.accessLogFormat = format
+		s.accessLogWriter = writer
+	}
+}
+
 // New creates a new server with the required dependencies
 func New(reader FileReader, index Index, contentDir, assetDir, overviewFilePath string, metrics Metrics, opts ...Option) *Server {
 	s := &Server{
@@ -79,6 +220,9 @@ func New(reader FileReader, index Index, contentDir, assetDir, overviewFilePath
 		metrics:          metrics,
 		port:             3000,
 		allowedOrigins:   []string{},
+		contentDirs:      contentDirs{http.Dir(contentDir)},
+		accessLogFormat:  AccessLogStructured,
+		accessLogWriter:  os.Stdout,
 	}
 
 	// apply options
@@ -87,34 +231,54 @@ func New(reader FileReader, index Index, contentDir, assetDir, overviewFilePath
 	}
 
 	// serve static files
-	s.router.PathPrefix(fmt.Sprintf("/%s/", assetDir)).Handler(neuter(http.FileServer(http.Dir(contentDir))))
+	s.router.PathPrefix(fmt.Sprintf("/%s/", assetDir)).Handler(neuter(http.FileServer(s.contentDirs)))
 
 	// set up server routes
 	s.router.HandleFunc("/status", s.status)
+	if s.metricsHandler != nil {
+		s.router.Handle("/metrics", s.metricsHandler).Methods(http.MethodGet)
+	}
 	s.router.HandleFunc("/overview", s.getOverview)
 	s.router.HandleFunc("/recent", s.getRecent)
+	if s.views != nil {
+		s.router.HandleFunc("/popular", s.getPopular)
+	}
 	s.router.HandleFunc("/topics", s.listTopics)
-	s.router.HandleFunc("/topics/{topic}", s.getTopic)
-	s.router.HandleFunc("/topics/{topic}/articles", s.listArticles)
-	s.router.HandleFunc("/topics/{topic}/articles/{article}", s.getArticle)
-	s.router.Use(loggingMiddleware)
-	s.router.Use(s.recordingMiddleware)
+	// nested topics have a slug for each level, so the longest routes are matched first
+	if s.history != nil {
+		s.router.HandleFunc("/topics/{topic:.+}/articles/{article}/revisions/{sha}", s.getRevision)
+		s.router.HandleFunc("/topics/{topic:.+}/articles/{article}/revisions", s.listRevisions)
+	}
+	s.router.HandleFunc("/topics/{topic:.+}/articles/{article}/related", s.getRelated)
+	s.router.HandleFunc("/topics/{topic:.+}/articles/{article}", s.getArticle)
+	s.router.HandleFunc("/topics/{topic:.+}/articles", s.listArticles)
+	s.router.HandleFunc("/topics/{topic:.+}", s.getTopic)
+	s.router.HandleFunc("/graph", s.getGraph)
+	s.router.HandleFunc("/series", s.listSeries)
+	s.router.HandleFunc("/series/{series}", s.getSeries)
+	if s.adminToken != "" {
+		s.registerAdminRoutes(s.router.PathPrefix("/admin").Subrouter())
+	}
+	s.router.Use(tracingMiddleware)
+	s.router.Use(routeMiddleware)
+	s.router.Use(recoveryMiddleware)
 
+	// requests which match no route are still given an ID, logged and recorded
 	c := cors.New(cors.Options{
 		AllowedOrigins: s.allowedOrigins,
 	})
-
-	s.srv = &http.Server{
-		Addr:         fmt.Sprintf("0.0.0.0:%d", s.port),
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		Handler:      c.Handler(s.router),
-	}
+	s.handler = requestIDMiddleware(s.accessLogMiddleware(s.recordingMiddleware(c.Handler(s.router))))
+	s.srv = newHTTPServer(s.port, s.handler)
 
 	return s
 }
 
+// Handler returns the handler which serves every request, for use when the server is hosted
+// by a tenant server
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
 func (s *Server) status(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(StatusResponse{
@@ -124,9 +288,9 @@ func (s *Server) status(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getOverview(w http.ResponseWriter, r *http.Request) {
-	content, err := s.reader.ReadFileAsHTML(s.overviewFilePath)
+	content, err := s.reader.ReadFileAsHTML(r.Context(), s.overviewFilePath)
 	if err != nil {
-		slog.Error("failed to read overview file", "path", s.overviewFilePath, "error", err)
+		Logger(r.Context()).Error("failed to read overview file", "path", s.overviewFilePath, "error", err)
 		s.internalError(w, r)
 		return
 	}
@@ -148,12 +312,12 @@ func (s *Server) getRecent(w http.ResponseWriter, r *http.Request) {
 	for i, article := range recentArticles {
 		articleTopic := s.index.GetTopicByIdentifier(article.TopicSlug)
 		if articleTopic == nil {
-			slog.Error("failed to find topic for article", "article", article.Slug)
+			Logger(r.Context()).Error("failed to find topic for article", "article", article.Slug)
 			sentry.CaptureException(errors.Errorf("failed to find topic for article %s", article.Slug))
 			continue
 		}
 
-		convertedArticles[i] = convertArticle(articleTopic, article)
+		convertedArticles[i] = s.convertArticle(articleTopic, article)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -163,12 +327,12 @@ func (s *Server) getRecent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) listTopics(w http.ResponseWriter, r *http.Request) {
-	topics := s.index.GetAllTopics()
-	topicResponses := make([]Topic, len(topics))
-	i := 0
-	for _, topic := range topics {
-		topicResponses[i] = convertTopic(topic, s.index.GetAllArticlesForTopic(topic.Slug))
-		i++
+	topicResponses := []Topic{}
+	for _, topic := range s.index.GetAllTopics() {
+		if topic.IsExpired() {
+			continue
+		}
+		topicResponses = append(topicResponses, s.convertTopic(topic))
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -183,12 +347,17 @@ func (s *Server) listArticles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	topicArticles := s.index.GetAllArticlesForTopic(vars["topic"])
-	articles := make([]Article, len(topicArticles))
-	i := 0
-	for _, article := range topicArticles {
-		articles[i] = convertArticle(topic, article)
-		i++
+	if topic.IsExpired() {
+		s.expired(w, r)
+		return
+	}
+
+	articles := []Article{}
+	for _, article := range s.index.GetAllArticlesForTopic(vars["topic"]) {
+		if article.IsExpired() {
+			continue
+		}
+		articles = append(articles, s.convertArticle(topic, article))
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -209,18 +378,81 @@ func (s *Server) getArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content, err := s.reader.ReadFileAsHTML(article.FilePath)
+	if topic.IsExpired() || article.IsExpired() {
+		s.expired(w, r)
+		return
+	}
+
+	content, err := s.reader.ReadFileAsHTML(r.Context(), article.FilePath)
 	if err != nil {
-		slog.Error("failed to read article file", "topic", vars["topic"], "article", vars["article"], "error", err)
+		Logger(r.Context()).Error("failed to read article file", "topic", vars["topic"], "article", vars["article"], "error", err)
 		s.internalError(w, r)
 		return
 	}
 
+	if s.countViews {
+		s.metrics.ContentViewed(topic.Slug, article.Slug)
+	}
+	if s.views != nil {
+		s.views.Record(topic.Slug, article.Slug, s.visitorAddress(r), r.UserAgent())
+	}
+
+	response := GetArticleResponse{
+		Article:      s.convertArticle(topic, article),
+		HtmlResponse: HtmlResponse{content},
+		Related:      s.relatedArticles(r, article),
+		Backlinks:    s.backlinks(r, article),
+		Series:       s.articleSeries(article),
+	}
+	previous, next := s.index.GetAdjacentArticles(topic.Slug, article.Slug)
+	if previous != nil {
+		converted := s.convertArticle(topic, previous)
+		response.Previous = &converted
+	}
+	if next != nil {
+		converted := s.convertArticle(topic, next)
+		response.Next = &converted
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(GetArticleResponse{
-		convertArticle(topic, article),
-		HtmlResponse{content},
-	})
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) getRelated(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	topic := s.index.GetTopicByIdentifier(vars["topic"])
+	if topic == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	article := s.index.GetArticleByIdentifier(vars["topic"], vars["article"])
+	if article == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	if topic.IsExpired() || article.IsExpired() {
+		s.expired(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListArticlesResponse{s.relatedArticles(r, article)})
+}
+
+// relatedArticles converts the articles related to the given article
+func (s *Server) relatedArticles(r *http.Request, article *model.Article) []Article {
+	related := []Article{}
+	for _, relatedArticle := range s.index.GetRelatedArticles(article.TopicSlug, article.Slug) {
+		relatedTopic := s.index.GetTopicByIdentifier(relatedArticle.TopicSlug)
+		if relatedTopic == nil {
+			Logger(r.Context()).Error("failed to find topic for article", "article", relatedArticle.Slug)
+			continue
+		}
+		related = append(related, s.convertArticle(relatedTopic, relatedArticle))
+	}
+	return related
 }
 
 func (s *Server) getTopic(w http.ResponseWriter, r *http.Request) {
@@ -231,16 +463,25 @@ func (s *Server) getTopic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content, err := s.reader.ReadFileAsHTML(topic.FilePath)
+	if topic.IsExpired() {
+		s.expired(w, r)
+		return
+	}
+
+	content, err := s.reader.ReadFileAsHTML(r.Context(), topic.FilePath)
 	if err != nil {
-		slog.Error("failed to read topic file", "topic", vars["topic"], "error", err)
+		Logger(r.Context()).Error("failed to read topic file", "topic", vars["topic"], "error", err)
 		s.internalError(w, r)
 		return
 	}
 
+	if s.countViews {
+		s.metrics.ContentViewed(topic.Slug, "")
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(GetTopicResponse{
-		convertTopic(topic, s.index.GetAllArticlesForTopic(vars["topic"])),
+		s.convertTopic(topic),
 		HtmlResponse{content},
 	})
 }
@@ -250,22 +491,24 @@ func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(ErrorResponse{"not found"})
 }
 
+// expired responds to requests for expired topics and articles
+func (s *Server) expired(w http.ResponseWriter, r *http.Request) {
+	if !s.goneForExpired {
+		s.notFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusGone)
+	json.NewEncoder(w).Encode(ErrorResponse{"gone"})
+}
+
 func (s *Server) internalError(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusInternalServerError)
 	json.NewEncoder(w).Encode(ErrorResponse{"internal error"})
 }
 
-func (s *Server) recordingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
-		defer s.metrics.Request(r.RequestURI, startTime)
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (s *Server) ListenAndServe() {
 	slog.Info("server listening", "addr", s.srv.Addr)
-	if err := s.srv.ListenAndServe(); err != nil {
+	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("failed to serve", "error", err)
 		os.Exit(1)
 	}
@@ -280,60 +523,125 @@ func (s *Server) Shutdown() {
 	}
 }
 
-func buildTopicUrl(topic *model.Topic) string {
-	return fmt.Sprintf("/topics/%s", topic.Slug)
+func (s *Server) buildTopicUrl(topic *model.Topic) string {
+	return fmt.Sprintf("%s/topics/%s", s.pathPrefix, topic.Slug)
 }
 
-func buildTopicArticlesUrl(topic *model.Topic) string {
-	return fmt.Sprintf("%s/articles", buildTopicUrl(topic))
+func (s *Server) buildTopicArticlesUrl(topic *model.Topic) string {
+	return fmt.Sprintf("%s/articles", s.buildTopicUrl(topic))
 }
 
-func buildArticleUrl(topic *model.Topic, article *model.Article) string {
-	return fmt.Sprintf("%s/%s", buildTopicArticlesUrl(topic), article.Slug)
+func (s *Server) buildArticleUrl(topic *model.Topic, article *model.Article) string {
+	return fmt.Sprintf("%s/%s", s.buildTopicArticlesUrl(topic), article.Slug)
 }
 
-func convertTopic(topic *model.Topic, articles []*model.Article) Topic {
+func (s *Server) convertTopic(topic *model.Topic) Topic {
 	publishedArticleCount := 0
-	for _, article := range articles {
+	for _, article := range s.index.GetAllArticlesForTopic(topic.Slug) {
 		if article.IsPublished() {
 			publishedArticleCount++
 		}
 	}
 
+	children := []TopicLink{}
+	for _, childSlug := range topic.Children {
+		if child := s.index.GetTopicByIdentifier(childSlug); child != nil && !child.IsExpired() {
+			children = append(children, s.convertTopicLink(child))
+		}
+	}
+
 	return Topic{
-		CommonItemResponse{
+		CommonItemResponse: CommonItemResponse{
 			Title:       topic.Title,
 			Description: topic.Description,
 			Hidden:      topic.Hidden,
 			Image:       topic.Image,
-			URL:         buildTopicUrl(topic),
+			URL:         s.buildTopicUrl(topic),
 			Priority:    topic.Priority,
 			Slug:        topic.Slug,
+			Source:      topic.Source,
 			PublishedAt: topic.PublishedAt,
+			ExpiresAt:   topic.ExpiresAt,
 			UpdatedAt:   topic.UpdatedAt,
 			Metadata:    topic.Metadata,
 		},
-		buildTopicArticlesUrl(topic),
-		publishedArticleCount,
+		ArticleURL:                 s.buildTopicArticlesUrl(topic),
+		PublishedArticleCount:      publishedArticleCount,
+		TotalPublishedArticleCount: s.index.GetPublishedArticleCount(topic.Slug),
+		ParentSlug:                 topic.ParentSlug,
+		Children:                   children,
+		Breadcrumbs:                s.breadcrumbs(topic),
 	}
 }
 
-func convertArticle(topic *model.Topic, article *model.Article) Article {
+// breadcrumbs returns links to the given topic and every topic it is nested within, from the
+// top level topic down
+func (s *Server) breadcrumbs(topic *model.Topic) []TopicLink {
+	breadcrumbs := []TopicLink{s.convertTopicLink(topic)}
+	for parentSlug := topic.ParentSlug; parentSlug != ""; {
+		parent := s.index.GetTopicByIdentifier(parentSlug)
+		if parent == nil {
+			break
+		}
+		breadcrumbs = append([]TopicLink{s.convertTopicLink(parent)}, breadcrumbs...)
+		parentSlug = parent.ParentSlug
+	}
+	return breadcrumbs
+}
+
+func (s *Server) convertTopicLink(topic *model.Topic) TopicLink {
+	return TopicLink{
+		Title: topic.Title,
+		Slug:  topic.Slug,
+		URL:   s.buildTopicUrl(topic),
+	}
+}
+
+func (s *Server) convertArticle(topic *model.Topic, article *model.Article) Article {
+	tags := article.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	views := 0
+	if s.views != nil {
+		views = s.views.GetViews(topic.Slug, article.Slug)
+	}
+
 	return Article{
 		CommonItemResponse{
 			Title:       article.Title,
 			Description: article.Description,
 			Hidden:      article.Hidden,
 			Image:       article.Image,
-			URL:         buildArticleUrl(topic, article),
+			URL:         s.buildArticleUrl(topic, article),
 			Priority:    article.Priority,
 			Slug:        article.Slug,
+			Source:      article.Source,
 			PublishedAt: article.PublishedAt,
+			ExpiresAt:   article.ExpiresAt,
 			UpdatedAt:   article.UpdatedAt,
 			Metadata:    article.Metadata,
 		},
 		topic.Slug,
+		tags,
+		views,
+		s.breadcrumbs(topic),
+	}
+}
+
+// contentDirs serves files from the first directory which contains them
+type contentDirs []http.Dir
+
+func (d contentDirs) Open(name string) (http.File, error) {
+	var err error
+	for _, dir := range d {
+		var file http.File
+		if file, err = dir.Open(name); err == nil {
+			return file, nil
+		}
 	}
+	return nil, err
 }
 
 func neuter(next http.Handler) http.Handler {
@@ -346,10 +654,3 @@ func neuter(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("request", "method", r.Method, "uri", r.RequestURI)
-		next.ServeHTTP(w, r)
-	})
-}
@@ -0,0 +1,239 @@
+package serving_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/serving"
+)
+
+// stubReader panics when reading panic.md and aborts the handler when reading abort.md
+type stubReader struct{}
+
+func (stubReader) ReadFileAsHTML(ctx context.Context, filepath string) (string, error) {
+	switch filepath {
+	case "panic.md":
+		panic("failed to read file")
+	case "abort.md":
+		panic(http.ErrAbortHandler)
+	}
+	return "<p>" + filepath + "</p>", nil
+}
+
+func (stubReader) RenderHTML(ctx context.Context, contents []byte, filepath string) (string, error) {
+	return string(contents), nil
+}
+
+// stubIndex serves a fixed set of topics and articles
+type stubIndex struct {
+	topics   []*model.Topic
+	articles []*model.Article
+	graph    *model.Graph
+}
+
+func (i *stubIndex) GetLastIndexedTime() time.Time { return time.Time{} }
+func (i *stubIndex) GetAllTopics() []*model.Topic  { return i.topics }
+
+func (i *stubIndex) GetTopicByIdentifier(topicIdentifier string) *model.Topic {
+	for _, topic := range i.topics {
+		if topic.Slug == topicIdentifier {
+			return topic
+		}
+	}
+	return nil
+}
+
+func (i *stubIndex) GetArticleByIdentifier(topicIdentifier, identifier string) *model.Article {
+	for _, article := range i.articles {
+		if article.TopicSlug == topicIdentifier && article.Slug == identifier {
+			return article
+		}
+	}
+	return nil
+}
+
+func (i *stubIndex) GetAllArticlesForTopic(topicIdentifier string) []*model.Article {
+	articles := []*model.Article{}
+	for _, article := range i.articles {
+		if article.TopicSlug == topicIdentifier {
+			articles = append(articles, article)
+		}
+	}
+	return articles
+}
+
+func (i *stubIndex) GetRecentArticles(limit int) []*model.Article { return i.articles }
+func (i *stubIndex) GetRelatedArticles(topicIdentifier, identifier string) []*model.Article {
+	return nil
+}
+func (i *stubIndex) GetAdjacentArticles(topicIdentifier, identifier string) (previous, next *model.Article) {
+	return nil, nil
+}
+func (i *stubIndex) GetAllSeries() []*model.Series                         { return nil }
+func (i *stubIndex) GetSeriesByIdentifier(identifier string) *model.Series { return nil }
+func (i *stubIndex) GetBacklinks(filepath string) []*model.Article         { return nil }
+func (i *stubIndex) GetGraph() *model.Graph                                { return i.graph }
+func (i *stubIndex) GetPublishedArticleCount(topicIdentifier string) int   { return 0 }
+
+// recordedRequest holds the labels of a request passed to the metrics
+type recordedRequest struct {
+	route  string
+	status int
+}
+
+type stubMetrics struct {
+	lock     sync.Mutex
+	requests []recordedRequest
+}
+
+func (m *stubMetrics) Request(route, method string, status int, bytes int64, startTime time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests = append(m.requests, recordedRequest{route, status})
+}
+
+func (m *stubMetrics) ContentViewed(topic, article string) {}
+
+func newTestServer(index *stubIndex, metrics *stubMetrics, opts ...serving.Option) *serving.Server {
+	opts = append([]serving.Option{serving.WithAccessLog(serving.AccessLogStructured, io.Discard)}, opts...)
+	return serving.New(stubReader{}, index, "", "assets", "README.md", metrics, opts...)
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoutesNestedTopics(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	index := &stubIndex{
+		topics: []*model.Topic{
+			{Slug: "go", FilePath: "go/README.md", Children: []string{"go/testing"}, PublishedAt: published},
+			{Slug: "go/testing", ParentSlug: "go", FilePath: "go/testing/README.md", PublishedAt: published},
+		},
+		articles: []*model.Article{
+			{Slug: "intro", TopicSlug: "go", FilePath: "go/intro.md", PublishedAt: published},
+			{Slug: "testing", TopicSlug: "go", FilePath: "go/testing.md", PublishedAt: published},
+			{Slug: "mocks", TopicSlug: "go/testing", FilePath: "go/testing/mocks.md", PublishedAt: published},
+		},
+	}
+	s := newTestServer(index, &stubMetrics{})
+
+	for path, tc := range map[string]struct {
+		status   int
+		expected string
+	}{
+		"/topics/go":                                {http.StatusOK, `{"slug": "go"}`},
+		"/topics/go/testing":                        {http.StatusOK, `{"slug": "go/testing"}`},
+		"/topics/go/articles":                       {http.StatusOK, `{"articles": [{"slug": "intro", "topicSlug": "go"}, {"slug": "testing", "topicSlug": "go"}]}`},
+		"/topics/go/articles/testing":               {http.StatusOK, `{"slug": "testing", "topicSlug": "go"}`},
+		"/topics/go/testing/articles":               {http.StatusOK, `{"articles": [{"slug": "mocks", "topicSlug": "go/testing"}]}`},
+		"/topics/go/testing/articles/mocks":         {http.StatusOK, `{"slug": "mocks", "topicSlug": "go/testing"}`},
+		"/topics/go/testing/articles/mocks/related": {http.StatusOK, `{"articles": []}`},
+		"/topics/go/missing":                        {http.StatusNotFound, ""},
+		"/topics/go/testing/articles/missing":       {http.StatusNotFound, ""},
+	} {
+		t.Run(path, func(t *testing.T) {
+			w := serve(s.Handler(), httptest.NewRequest(http.MethodGet, path, nil))
+			require.Equal(t, tc.status, w.Code)
+			if tc.expected != "" {
+				requireJSONSubset(t, tc.expected, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestHidesExpiredTopicsAndArticles(t *testing.T) {
+	published := time.Now().Add(-time.Hour).Unix()
+	expired := time.Now().Add(-time.Minute).Unix()
+	index := &stubIndex{
+		topics: []*model.Topic{
+			{Slug: "go", FilePath: "go/README.md", PublishedAt: published},
+			{Slug: "old", FilePath: "old/README.md", PublishedAt: published, ExpiresAt: expired},
+		},
+		articles: []*model.Article{
+			{Slug: "intro", TopicSlug: "go", FilePath: "go/intro.md", PublishedAt: published},
+			{Slug: "outdated", TopicSlug: "go", FilePath: "go/outdated.md", PublishedAt: published, ExpiresAt: expired},
+			{Slug: "intro", TopicSlug: "old", FilePath: "old/intro.md", PublishedAt: published},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		opts    []serving.Option
+		expired int
+	}{
+		"not found": {nil, http.StatusNotFound},
+		"gone":      {[]serving.Option{serving.WithGoneForExpired()}, http.StatusGone},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(index, &stubMetrics{}, tc.opts...)
+			for path, status := range map[string]int{
+				"/topics/go/articles/outdated":         tc.expired,
+				"/topics/go/articles/outdated/related": tc.expired,
+				"/topics/old":                          tc.expired,
+				"/topics/old/articles":                 tc.expired,
+				"/topics/old/articles/intro":           tc.expired,
+				"/topics/go/articles/missing":          http.StatusNotFound,
+				"/topics/go/articles/intro":            http.StatusOK,
+			} {
+				w := serve(s.Handler(), httptest.NewRequest(http.MethodGet, path, nil))
+				require.Equal(t, status, w.Code, path)
+			}
+
+			// listings leave out anything which has expired
+			w := serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/topics", nil))
+			requireJSONSubset(t, `{"topics": [{"slug": "go"}]}`, w.Body.Bytes())
+			w = serve(s.Handler(), httptest.NewRequest(http.MethodGet, "/topics/go/articles", nil))
+			requireJSONSubset(t, `{"articles": [{"slug": "intro"}]}`, w.Body.Bytes())
+		})
+	}
+}
+
+// requireJSONSubset ensures every field in the expected JSON has the same value in the actual
+// JSON, ignoring any other fields
+func requireJSONSubset(t *testing.T, expected string, actual []byte) {
+	t.Helper()
+	var expectedValue, actualValue any
+	require.NoError(t, json.Unmarshal([]byte(expected), &expectedValue))
+	require.NoError(t, json.Unmarshal(actual, &actualValue))
+	require.Equal(t, expectedValue, subset(expectedValue, actualValue))
+}
+
+// subset returns the parts of the actual value which are present in the expected value
+func subset(expected, actual any) any {
+	switch expectedValue := expected.(type) {
+	case map[string]any:
+		actualMap, ok := actual.(map[string]any)
+		if !ok {
+			return actual
+		}
+		result := map[string]any{}
+		for key, value := range expectedValue {
+			if actualValue, ok := actualMap[key]; ok {
+				result[key] = subset(value, actualValue)
+			}
+		}
+		return result
+	case []any:
+		actualSlice, ok := actual.([]any)
+		if !ok || len(actualSlice) != len(expectedValue) {
+			return actual
+		}
+		result := make([]any, len(actualSlice))
+		for i := range actualSlice {
+			result[i] = subset(expectedValue[i], actualSlice[i])
+		}
+		return result
+	}
+	return actual
+}
@@ -0,0 +1,121 @@
+package serving
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tenant defines a blog hosted alongside others by a tenant server
+type Tenant struct {
+	Name string
+	// Requests for any of the given hosts are routed to the tenant
+	Hosts []string
+	// Requests starting with the given path prefix are routed to the tenant with the prefix
+	// removed. Tenants with hosts as well are only served beneath the prefix on those hosts
+	PathPrefix string
+	Server     *Server
+}
+
+// TenantServer routes every request to the server of the tenant it was made for
+type TenantServer struct {
+	tenants []*Tenant
+	srv     *http.Server
+}
+
+// NewTenantServer creates a new server which hosts the given tenants on the given port
+func NewTenantServer(port int, tenants []*Tenant) *TenantServer {
+	s := &TenantServer{
+		tenants: tenants,
+	}
+	s.srv = newHTTPServer(port, s)
+
+	return s
+}
+
+// ServeHTTP passes the request to the tenant matching the request host. Otherwise, the tenant
+// with the longest matching path prefix is used
+func (s *TenantServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := s.tenantForHost(r.Host)
+	if tenant == nil {
+		tenant = s.tenantForPath(r.URL.Path)
+	}
+	if tenant == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the prefix is removed for host matches too, as the tenant adds it to every URL it returns
+	if prefix := strings.TrimRight(tenant.PathPrefix, "/"); prefix != "" {
+		http.StripPrefix(prefix, tenant.Server.Handler()).ServeHTTP(w, r)
+		return
+	}
+	tenant.Server.Handler().ServeHTTP(w, r)
+}
+
+func (s *TenantServer) tenantForHost(host string) *Tenant {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, tenant := range s.tenants {
+		for _, tenantHost := range tenant.Hosts {
+			if strings.EqualFold(tenantHost, host) {
+				return tenant
+			}
+		}
+	}
+	return nil
+}
+
+func (s *TenantServer) tenantForPath(path string) *Tenant {
+	var match *Tenant
+	for _, tenant := range s.tenants {
+		prefix := strings.TrimRight(tenant.PathPrefix, "/")
+		if prefix != "" && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		// tenants without hosts or a prefix catch every request which no other tenant matches
+		if prefix == "" && len(tenant.Hosts) > 0 {
+			continue
+		}
+		if match == nil || len(prefix) > len(strings.TrimRight(match.PathPrefix, "/")) {
+			match = tenant
+		}
+	}
+	return match
+}
+
+func (s *TenantServer) ListenAndServe() {
+	slog.Info("tenant server listening", "addr", s.srv.Addr, "tenants", len(s.tenants))
+	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("failed to serve", "error", err)
+		os.Exit(1)
+	}
+}
+
+func (s *TenantServer) Shutdown() {
+	slog.Info("tenant server shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		slog.Error("server shutdown error", "error", err)
+	}
+}
+
+func newHTTPServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf("0.0.0.0:%d", port),
+		WriteTimeout: time.Second * 15,
+		ReadTimeout:  time.Second * 15,
+		IdleTimeout:  time.Second * 60,
+		Handler:      handler,
+	}
+}
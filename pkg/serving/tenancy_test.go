@@ -0,0 +1,84 @@
+package serving_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/serving"
+)
+
+// newTenant creates a tenant whose only topic has the tenant's name as its slug
+func newTenant(name string, hosts []string, pathPrefix string) *serving.Tenant {
+	published := time.Now().Add(-time.Hour).Unix()
+	index := &stubIndex{
+		topics:   []*model.Topic{{Slug: name, PublishedAt: published}},
+		articles: []*model.Article{{Slug: "intro", TopicSlug: name, PublishedAt: published}},
+		graph: &model.Graph{Nodes: []*model.GraphNode{
+			{ID: "article:" + name + "/intro", Type: model.GraphNodeArticle, TopicSlug: name, Slug: "intro"},
+		}},
+	}
+	return &serving.Tenant{
+		Name:       name,
+		Hosts:      hosts,
+		PathPrefix: pathPrefix,
+		Server:     newTestServer(index, &stubMetrics{}, serving.WithPathPrefix(pathPrefix)),
+	}
+}
+
+func TestRoutesRequestsToTenants(t *testing.T) {
+	tenants := serving.NewTenantServer(0, []*serving.Tenant{
+		newTenant("main", []string{"blog.example.com"}, ""),
+		newTenant("docs", nil, "/docs"),
+		newTenant("guides", nil, "/docs/guides/"),
+		newTenant("fallback", nil, ""),
+		newTenant("hosted", []string{"hosted.example.com"}, "/blog"),
+	})
+
+	for name, tc := range map[string]struct {
+		host     string
+		path     string
+		status   int
+		expected string
+	}{
+		"host":                    {"blog.example.com", "/topics", http.StatusOK, `{"topics": [{"slug": "main"}]}`},
+		"host with port":          {"BLOG.example.com:8080", "/topics", http.StatusOK, `{"topics": [{"slug": "main"}]}`},
+		"host before path prefix": {"blog.example.com", "/docs/topics", http.StatusNotFound, ""},
+		"path prefix":             {"api.example.com", "/docs/topics", http.StatusOK, `{"topics": [{"slug": "docs"}]}`},
+		"longest path prefix":     {"api.example.com", "/docs/guides/topics", http.StatusOK, `{"topics": [{"slug": "guides"}]}`},
+		"partial path prefix":     {"api.example.com", "/docsearch/topics", http.StatusNotFound, ""},
+		"fallback":                {"api.example.com", "/topics", http.StatusOK, `{"topics": [{"slug": "fallback"}]}`},
+		"prefixed topic url":      {"api.example.com", "/docs/topics/docs", http.StatusOK, `{"url": "/docs/topics/docs", "articleUrl": "/docs/topics/docs/articles"}`},
+		"prefixed article url":    {"api.example.com", "/docs/guides/topics/guides/articles", http.StatusOK, `{"articles": [{"url": "/docs/guides/topics/guides/articles/intro"}]}`},
+		"unprefixed url":          {"blog.example.com", "/topics/main/articles/intro", http.StatusOK, `{"url": "/topics/main/articles/intro"}`},
+		"prefixed graph url":      {"api.example.com", "/docs/graph", http.StatusOK, `{"nodes": [{"url": "/docs/topics/docs/articles/intro"}]}`},
+		"prefixed breadcrumbs":    {"api.example.com", "/docs/topics/docs", http.StatusOK, `{"breadcrumbs": [{"url": "/docs/topics/docs"}]}`},
+		"host and path prefix":    {"hosted.example.com", "/blog/topics/hosted", http.StatusOK, `{"url": "/blog/topics/hosted"}`},
+		"host without prefix":     {"hosted.example.com", "/topics", http.StatusNotFound, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Host = tc.host
+			w := serve(tenants, r)
+			require.Equal(t, tc.status, w.Code)
+			if tc.expected != "" {
+				requireJSONSubset(t, tc.expected, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestRejectsRequestsWithoutATenant(t *testing.T) {
+	tenants := serving.NewTenantServer(0, []*serving.Tenant{
+		newTenant("main", []string{"blog.example.com"}, ""),
+		newTenant("docs", nil, "/docs"),
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/topics", nil)
+	r.Host = "api.example.com"
+	require.Equal(t, http.StatusNotFound, serve(tenants, r).Code)
+}
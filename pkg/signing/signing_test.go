@@ -0,0 +1,16 @@
+package signing_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/signing"
+)
+
+func TestSignsTheTimestampAndBody(t *testing.T) {
+	// echo -n '1700000000.{"paths":["/"]}' | openssl dgst -sha256 -hmac secret
+	require.Equal(t, "8d794d2f75d9e6ea8b1743605e6c26c0a688a306a1cf805805a6601eb7f31e5a", signing.Sign("secret", "1700000000", []byte(`{"paths":["/"]}`)))
+	require.NotEqual(t, signing.Sign("secret", "1700000000", []byte("body")), signing.Sign("secret", "1700000001", []byte("body")))
+	require.NotEqual(t, signing.Sign("secret", "1700000000", []byte("body")), signing.Sign("other", "1700000000", []byte("body")))
+}
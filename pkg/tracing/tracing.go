@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	// ExporterNone disables tracing, although trace context is still propagated
+	ExporterNone = "none"
+	// ExporterOTLP exports spans to an OTLP collector over HTTP
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stdout, which is useful when developing locally
+	ExporterStdout = "stdout"
+)
+
+// Provider records spans and exports them in the background
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+type options struct {
+	serviceName  string
+	environment  string
+	sampleRatio  float64
+	otlpEndpoint string
+	writer       io.Writer
+}
+
+// Option defines the function used to set options
+type Option func(*options)
+
+// WithServiceName specifies the name of the service which every span is attributed to
+func WithServiceName(name string) Option {
+	return func(o *options) {
+		o.serviceName = name
+	}
+}
+
+// WithEnvironment specifies the environment which every span is attributed to
+func WithEnvironment(environment string) Option {
+	return func(o *options) {
+		o.environment = environment
+	}
+}
+
+// WithSampleRatio specifies the ratio of new traces which are recorded. Traces started by a
+// caller follow the caller's sampling decision
+func WithSampleRatio(ratio float64) Option {
+	return func(o *options) {
+		o.sampleRatio = ratio
+	}
+}
+
+// WithOTLPEndpoint specifies the URL of the OTLP collector, otherwise the standard
+// OTEL_EXPORTER_OTLP_ environment variables are used
+func WithOTLPEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.otlpEndpoint = endpoint
+	}
+}
+
+// WithWriter specifies where the stdout exporter writes spans to
+func WithWriter(writer io.Writer) Option {
+	return func(o *options) {
+		o.writer = writer
+	}
+}
+
+// New sets up tracing using the given exporter, registering the provider globally so every
+// package can start spans. W3C trace context is propagated whichever exporter is used
+func New(exporter string, opts ...Option) (*Provider, error) {
+	o := &options{
+		serviceName: "blog-server",
+		sampleRatio: 1,
+		writer:      os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return &Provider{}, nil
+	case ExporterOTLP:
+		exporterOptions := []otlptracehttp.Option{}
+		if o.otlpEndpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(o.otlpEndpoint))
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), exporterOptions...)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(o.writer))
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s exporter", exporter)
+	}
+
+	attributes := []resource.Option{
+		resource.WithAttributes(semconv.ServiceName(o.serviceName)),
+	}
+	if o.environment != "" {
+		attributes = append(attributes, resource.WithAttributes(semconv.DeploymentEnvironment(o.environment)))
+	}
+	res, err := resource.New(context.Background(), attributes...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tracing resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return &Provider{provider: provider}, nil
+}
+
+// Shutdown exports any remaining spans and stops the provider
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.provider == nil {
+		return nil
+	}
+	return errors.Wrap(p.provider.Shutdown(ctx), "failed to shut down tracing")
+}
@@ -0,0 +1,36 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/wamphlett/blog-server/pkg/tracing"
+)
+
+func TestExportsSpansContinuingIncomingTraces(t *testing.T) {
+	buf := &bytes.Buffer{}
+	provider, err := tracing.New(tracing.ExporterStdout, tracing.WithWriter(buf), tracing.WithServiceName("test"))
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span := otel.Tracer("test").Start(ctx, "GET /topics/{topic}")
+	span.End()
+
+	require.NoError(t, provider.Shutdown(context.Background()))
+	require.Contains(t, buf.String(), `"Name":"GET /topics/{topic}"`)
+	require.Contains(t, buf.String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	require.Contains(t, buf.String(), `"Value":"test"`)
+}
+
+func TestRejectsUnknownExporters(t *testing.T) {
+	_, err := tracing.New("zipkin")
+	require.Error(t, err)
+}
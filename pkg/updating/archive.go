@@ -0,0 +1,232 @@
+package updating
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ArchiveSource fetches content from a .tar.gz or .zip archive stored at a local file path or
+// an HTTP URL. Archives served over HTTP are only downloaded again when their ETag changes
+type ArchiveSource struct {
+	location string
+	client   *http.Client
+
+	etag     string
+	revision string
+}
+
+// NewArchiveSource creates a new source for the archive at the given file path or URL
+func NewArchiveSource(location string) *ArchiveSource {
+	return &ArchiveSource{
+		location: location,
+		client:   http.DefaultClient,
+	}
+}
+
+// Fetch extracts the archive into the given directory if it has changed since the last fetch
+func (s *ArchiveSource) Fetch(dir string, fresh bool) error {
+	if fresh {
+		s.etag = ""
+		s.revision = ""
+	}
+
+	archive, err := s.download()
+	if err != nil {
+		return err
+	}
+	if archive == nil {
+		slog.Info("archive has not changed", "location", s.location)
+		return nil
+	}
+
+	revision := fmt.Sprintf("%x", sha256.Sum256(archive))[:40]
+	if _, err := os.Stat(dir); err == nil && revision == s.revision {
+		slog.Info("archive has not changed", "location", s.location)
+		return nil
+	}
+
+	slog.Info("extracting archive", "location", s.location, "revision", revision)
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "failed to clear content directory")
+	}
+	if err := extractArchive(archive, dir); err != nil {
+		return errors.Wrap(err, "failed to extract archive")
+	}
+
+	s.revision = revision
+	return nil
+}
+
+// Revision returns a hash of the most recently extracted archive
+func (s *ArchiveSource) Revision(dir string) (string, error) {
+	if s.revision == "" {
+		return "", errors.New("archive has not been fetched")
+	}
+	return s.revision, nil
+}
+
+// download reads the archive from its location. Nothing is returned if the archive is served
+// over HTTP and has not changed since the last download
+func (s *ArchiveSource) download() ([]byte, error) {
+	if !strings.HasPrefix(s.location, "http://") && !strings.HasPrefix(s.location, "https://") {
+		archive, err := os.ReadFile(s.location)
+		return archive, errors.Wrap(err, "failed to read archive")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.location, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create archive request")
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download archive")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to download archive: unexpected status %d", resp.StatusCode)
+	}
+
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download archive")
+	}
+
+	s.etag = resp.Header.Get("ETag")
+	return archive, nil
+}
+
+// extractArchive extracts the given .tar.gz or .zip archive into the given directory. If every
+// file in the archive sits within a single wrapping directory, that directory is stripped
+func extractArchive(archive []byte, dir string) error {
+	files := map[string][]byte{}
+	var err error
+	switch {
+	case bytes.HasPrefix(archive, []byte{0x1f, 0x8b}):
+		files, err = readTarGz(archive)
+	case bytes.HasPrefix(archive, []byte("PK")):
+		files, err = readZip(archive)
+	default:
+		err = errors.New("archive is not a .tar.gz or .zip file")
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix := commonDirectory(files)
+	for name, contents := range files {
+		target := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(name, prefix)))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return errors.Errorf("archive contains an invalid path: %s", name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, contents, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return os.MkdirAll(dir, 0o755)
+}
+
+func readTarGz(archive []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		contents, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = contents
+	}
+}
+
+func readZip(archive []byte) (map[string][]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		contents, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[file.Name] = contents
+	}
+	return files, nil
+}
+
+// commonDirectory returns the top level directory which holds every file, if there is one. The
+// directory is only considered a wrapper, such as those added to archives of git repositories,
+// if it contains further directories
+func commonDirectory(files map[string][]byte) string {
+	prefix := ""
+	nested := false
+	for name := range files {
+		i := strings.Index(name, "/")
+		if i == -1 {
+			return ""
+		}
+		if prefix == "" {
+			prefix = name[:i+1]
+		}
+		if name[:i+1] != prefix {
+			return ""
+		}
+		nested = nested || strings.Contains(name[i+1:], "/")
+	}
+
+	if !nested {
+		return ""
+	}
+	return prefix
+}
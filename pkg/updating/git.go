@@ -1,57 +1,98 @@
 package updating
 
 import (
+	"bytes"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
-func (u *Updater) updateFromRemote(forceFresh bool) error {
-	// if forcing the update, then remove the current content directory which
-	// will initiate a clone
-	if forceFresh {
-		if err := os.RemoveAll(u.path); err != nil {
-			return err
-		}
+// GitSource fetches content from a remote git repository
+type GitSource struct {
+	repo string
+}
+
+// NewGitSource creates a new source for the given remote repository
+func NewGitSource(repo string) *GitSource {
+	return &GitSource{
+		repo: repo,
 	}
+}
 
-	// if the content directory does not exist, clone the given repo
-	if _, err := os.Stat(u.path); os.IsNotExist(err) {
-		if err := u.clone(); err != nil {
+// Fetch clones the repository into the given directory, or pulls the recent changes if it
+// has already been cloned
+func (s *GitSource) Fetch(dir string, fresh bool) error {
+	// if forcing the update, then remove the current clone which will initiate a new clone
+	if fresh {
+		if err := os.RemoveAll(dir); err != nil {
 			return err
 		}
-		return nil
+	}
+
+	// if the directory does not exist, clone the given repo
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return s.clone(dir)
 	}
 	// pull recent changes
-	return u.pull()
+	return s.pull(dir)
+}
+
+// Revision returns the commit currently checked out in the given directory
+func (s *GitSource) Revision(dir string) (string, error) {
+	out, err := s.git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
 }
 
 // clone does a git clone from the remote repository
-func (u *Updater) clone() error {
-	slog.Info("cloning repository", "repo", u.repo)
-	cmd := exec.Command("git", "clone", u.repo, u.path)
+func (s *GitSource) clone(dir string) error {
+	slog.Info("cloning repository", "repo", s.repo)
+	cmd := exec.Command("git", "clone", s.repo, dir)
 	if out, err := cmd.CombinedOutput(); err != nil {
-		slog.Error("git clone failed", "repo", u.repo, "output", string(out), "error", err)
+		slog.Error("git clone failed", "repo", s.repo, "output", string(out), "error", err)
 		return err
 	}
-	slog.Info("repository cloned", "repo", u.repo)
+	slog.Info("repository cloned", "repo", s.repo)
 	return nil
 }
 
 // pull does a git pull from the remote repository
-func (u *Updater) pull() error {
-	slog.Info("pulling changes from repository", "repo", u.repo)
+func (s *GitSource) pull(dir string) error {
+	slog.Info("pulling changes from repository", "repo", s.repo)
 	cmd := exec.Command("git", "pull")
-	cmd.Env = []string{
-		fmt.Sprintf("GIT_DIR=%s/.git", u.path),
-		fmt.Sprintf("GIT_WORK_TREE=%s", u.path),
-	}
+	cmd.Env = gitEnv(dir)
 
 	if out, err := cmd.CombinedOutput(); err != nil {
-		slog.Error("git pull failed", "repo", u.repo, "output", string(out), "error", err)
+		slog.Error("git pull failed", "repo", s.repo, "output", string(out), "error", err)
 		return err
 	}
-	slog.Info("repository pulled", "repo", u.repo)
+	slog.Info("repository pulled", "repo", s.repo)
 	return nil
 }
+
+// git runs the given git command against the repository cloned in the given directory
+func (s *GitSource) git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Env = gitEnv(dir)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func gitEnv(dir string) []string {
+	return []string{
+		fmt.Sprintf("GIT_DIR=%s/.git", dir),
+		fmt.Sprintf("GIT_WORK_TREE=%s", dir),
+	}
+}
@@ -0,0 +1,90 @@
+package updating
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// Group combines several updaters, each managing their own content source, so that they can
+// be treated as one
+type Group []*Updater
+
+// GetFileRevisions returns every commit which touched the file at the given path, newest first.
+// Nothing is returned if the file's source does not have a history
+func (g Group) GetFileRevisions(filePath string) ([]*model.Revision, error) {
+	updater := g.updaterForFile(filePath)
+	if updater == nil {
+		return nil, errors.Errorf("file is not within any content directory: %s", filePath)
+	}
+	if !updater.HasHistory() {
+		return nil, nil
+	}
+	return updater.GetFileRevisions(filePath)
+}
+
+// GetFileAtRevision returns the revision along with the contents of the file at the given path
+// as they were at that revision. Nothing is returned if the file does not exist at the revision
+// or the file's source does not have a history
+func (g Group) GetFileAtRevision(filePath, sha string) (*model.Revision, []byte, error) {
+	updater := g.updaterForFile(filePath)
+	if updater == nil {
+		return nil, nil, errors.Errorf("file is not within any content directory: %s", filePath)
+	}
+	if !updater.HasHistory() {
+		return nil, nil, nil
+	}
+	return updater.GetFileAtRevision(filePath, sha)
+}
+
+// HasHistory reports whether any of the sources have a history
+func (g Group) HasHistory() bool {
+	for _, updater := range g {
+		if updater.HasHistory() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaged reports whether any of the sources are staged
+func (g Group) IsStaged() bool {
+	for _, updater := range g {
+		if updater.IsStaged() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetContentRevisions returns the staged revisions of every source
+func (g Group) GetContentRevisions() []*model.ContentRevision {
+	revisions := []*model.ContentRevision{}
+	for _, updater := range g {
+		revisions = append(revisions, updater.GetContentRevisions()...)
+	}
+	return revisions
+}
+
+// Rollback rolls back the source which staged the given revision
+func (g Group) Rollback(revision string) error {
+	for _, updater := range g {
+		if updater.findRevision(revision) != nil {
+			return updater.Rollback(revision)
+		}
+	}
+	return errors.Errorf("revision is not available: %s", revision)
+}
+
+// updaterForFile returns the updater whose content directory holds the given file
+func (g Group) updaterForFile(filePath string) *Updater {
+	for _, updater := range g {
+		if relativePath, err := filepath.Rel(updater.path, filePath); err == nil && !strings.HasPrefix(relativePath, "..") {
+			return updater
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package updating_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/updating"
+)
+
+// newStagedUpdater creates an updater which stages the content written to a new source directory,
+// returning the source and content directories along with it
+func newStagedUpdater(t *testing.T, name string) (*updating.Updater, string, string) {
+	t.Helper()
+	source, content := t.TempDir(), filepath.Join(t.TempDir(), name)
+	writeContent(t, source, map[string]string{name + "/README.md": "# " + name, name + "/one.md": "# One"})
+
+	u, err := updating.New(content, "README.md", stubReader{}, noopMetrics{},
+		updating.WithName(name),
+		updating.WithSource(updating.NewLocalSource(source)),
+	)
+	require.NoError(t, err)
+	return u, source, content
+}
+
+func TestGroupsUpdaters(t *testing.T) {
+	primary, primarySource, primaryContent := newStagedUpdater(t, "main")
+	other, _, _ := newStagedUpdater(t, "other")
+	group := updating.Group{primary, other}
+
+	require.True(t, group.IsStaged())
+	require.False(t, group.HasHistory())
+	require.False(t, updating.Group{}.IsStaged())
+
+	// every source's revisions are listed
+	revisions := group.GetContentRevisions()
+	require.Len(t, revisions, 2)
+	require.Equal(t, "main", revisions[0].Source)
+	require.Equal(t, "other", revisions[1].Source)
+
+	// rolling back is passed to the source which staged the revision
+	first := revisions[0].ID
+	writeContent(t, primarySource, map[string]string{"main/two.md": "# Two"})
+	require.NoError(t, primary.Update(false))
+	require.NotEqual(t, first, primary.GetContentRevisions()[0].ID)
+	require.NoError(t, group.Rollback(first))
+	require.True(t, primary.GetContentRevisions()[1].Live)
+	require.True(t, other.GetContentRevisions()[0].Live)
+	require.EqualError(t, group.Rollback("unknown"), "revision is not available: unknown")
+
+	// files are looked up in the source whose directory holds them
+	revisionList, err := group.GetFileRevisions(filepath.Join(t.TempDir(), "elsewhere.md"))
+	require.Error(t, err)
+	require.Nil(t, revisionList)
+	_, _, err = group.GetFileAtRevision(filepath.Join(t.TempDir(), "elsewhere.md"), "HEAD")
+	require.Error(t, err)
+
+	// sources without a history have no revisions
+	revisionList, err = group.GetFileRevisions(filepath.Join(primaryContent, "main", "one.md"))
+	require.NoError(t, err)
+	require.Nil(t, revisionList)
+	revision, contents, err := group.GetFileAtRevision(filepath.Join(primaryContent, "main", "one.md"), "HEAD")
+	require.NoError(t, err)
+	require.Nil(t, revision)
+	require.Nil(t, contents)
+}
@@ -0,0 +1,137 @@
+package updating
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+const (
+	fieldSeparator  = "\x1f"
+	recordSeparator = "\x1e"
+	revisionFormat  = "--format=%H%x1f%aI%x1f%an%x1f%s%x1e"
+)
+
+var shaRegex = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// notFoundMessages are the git errors which mean the revision, or the file at the revision,
+// does not exist
+var notFoundMessages = []string{
+	"bad revision",
+	"unknown revision",
+	"bad object",
+	"invalid object name",
+	"is ambiguous",
+	"does not exist in",
+	"exists on disk, but not in",
+}
+
+// GetFileRevisions returns every commit which touched the file at the given path, newest first
+func (u *Updater) GetFileRevisions(filePath string) ([]*model.Revision, error) {
+	git, relativePath, err := u.historyFor(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git.git(u.stagingPath(), "log", revisionFormat, u.liveRevision(), "--", relativePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read file history")
+	}
+
+	return parseRevisions(out), nil
+}
+
+// GetFileAtRevision returns the revision along with the contents of the file at the given path
+// as they were at that revision. Nothing is returned if the revision or the file at the revision
+// does not exist, but any other failure is returned as an error
+func (u *Updater) GetFileAtRevision(filePath, sha string) (*model.Revision, []byte, error) {
+	if !shaRegex.MatchString(sha) {
+		return nil, nil, nil
+	}
+
+	git, relativePath, err := u.historyFor(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := git.git(u.stagingPath(), "log", "-1", revisionFormat, sha, "--", relativePath)
+	if isNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read file revision")
+	}
+	revisions := parseRevisions(out)
+	if len(revisions) == 0 {
+		return nil, nil, nil
+	}
+
+	contents, err := git.git(u.stagingPath(), "show", fmt.Sprintf("%s:%s", revisions[0].SHA, filepath.ToSlash(relativePath)))
+	if isNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read file at revision")
+	}
+
+	return revisions[0], contents, nil
+}
+
+// HasHistory reports whether the content source keeps a history of every file
+func (u *Updater) HasHistory() bool {
+	_, ok := u.source.(*GitSource)
+	return ok
+}
+
+// historyFor returns the git source holding the history of the given file along with the
+// path of the file relative to the content directory
+func (u *Updater) historyFor(filePath string) (*GitSource, string, error) {
+	git, ok := u.source.(*GitSource)
+	if !ok {
+		return nil, "", errors.New("content is not sourced from a git repository")
+	}
+
+	relativePath, err := filepath.Rel(u.path, filePath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return nil, "", errors.Errorf("file is not within the content directory: %s", filePath)
+	}
+	return git, relativePath, nil
+}
+
+// isNotFound reports whether the git error was caused by a missing revision or file
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, message := range notFoundMessages {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRevisions(out []byte) []*model.Revision {
+	revisions := []*model.Revision{}
+	for _, record := range strings.Split(string(out), recordSeparator) {
+		fields := strings.Split(strings.TrimSpace(record), fieldSeparator)
+		if len(fields) != 4 {
+			continue
+		}
+
+		date, _ := time.Parse(time.RFC3339, fields[1])
+		revisions = append(revisions, &model.Revision{
+			SHA:     fields[0],
+			Date:    date.Unix(),
+			Author:  fields[2],
+			Message: fields[3],
+		})
+	}
+	return revisions
+}
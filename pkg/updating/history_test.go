@@ -0,0 +1,82 @@
+package updating_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/updating"
+)
+
+// runGit runs the given git command in the given directory, returning its output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Author", "-c", "user.email=author@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestReadsFileHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	runGit(t, repo, "init", "-q")
+	writeContent(t, repo, map[string]string{"go/README.md": "# Go", "go/intro.md": "# Intro"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "Add intro")
+	first := runGit(t, repo, "rev-parse", "HEAD")
+	writeContent(t, repo, map[string]string{"go/intro.md": "# Introduction", "go/next.md": "# Next"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "Rename intro")
+	second := runGit(t, repo, "rev-parse", "HEAD")
+
+	content := filepath.Join(t.TempDir(), "content")
+	u, err := updating.New(content, "README.md", stubReader{}, noopMetrics{}, updating.WithRemoteRepository(repo))
+	require.NoError(t, err)
+	require.True(t, u.HasHistory())
+	intro := filepath.Join(content, "go", "intro.md")
+
+	revisions, err := u.GetFileRevisions(intro)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	require.Equal(t, second, revisions[0].SHA)
+	require.Equal(t, "Rename intro", revisions[0].Message)
+	require.Equal(t, "Author", revisions[0].Author)
+	require.Equal(t, first, revisions[1].SHA)
+
+	revision, contents, err := u.GetFileAtRevision(intro, first[:8])
+	require.NoError(t, err)
+	require.Equal(t, first, revision.SHA)
+	require.Equal(t, "# Intro", string(contents))
+
+	// missing revisions and files are not found rather than failures
+	for name, tc := range map[string]struct {
+		filePath string
+		sha      string
+	}{
+		"invalid sha":              {intro, "not-a-sha"},
+		"unknown revision":         {intro, "deadbeef"},
+		"file added later":         {filepath.Join(content, "go", "next.md"), first},
+		"file which never existed": {filepath.Join(content, "go", "missing.md"), second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			revision, contents, err := u.GetFileAtRevision(tc.filePath, tc.sha)
+			require.NoError(t, err)
+			require.Nil(t, revision)
+			require.Nil(t, contents)
+		})
+	}
+
+	// anything else is a failure
+	require.NoError(t, os.RemoveAll(filepath.Join(content+".staging", ".git")))
+	_, _, err = u.GetFileAtRevision(intro, first)
+	require.Error(t, err)
+}
@@ -0,0 +1,284 @@
+package updating
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3Config defines the config used to connect to an S3-compatible bucket
+type S3Config struct {
+	// Endpoint is the base URL of the storage service, e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Source fetches content from an S3-compatible bucket using path-style requests. Objects
+// are only downloaded again when the bucket listing changes
+type S3Source struct {
+	cfg    S3Config
+	client *http.Client
+
+	revision string
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// NewS3Source creates a new source for the given bucket
+func NewS3Source(cfg S3Config) *S3Source {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+
+	return &S3Source{
+		cfg:    cfg,
+		client: http.DefaultClient,
+	}
+}
+
+// Fetch downloads every object under the configured prefix into the given directory if any
+// of the objects have changed since the last fetch
+func (s *S3Source) Fetch(dir string, fresh bool) error {
+	if fresh {
+		s.revision = ""
+	}
+
+	objects, err := s.listObjects()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]string, 0, len(objects))
+	for key, etag := range objects {
+		entries = append(entries, fmt.Sprintf("%s:%s", key, etag))
+	}
+	revision := hashStrings(entries)
+	if _, err := os.Stat(dir); err == nil && revision == s.revision {
+		slog.Info("bucket has not changed", "bucket", s.cfg.Bucket)
+		return nil
+	}
+
+	slog.Info("downloading bucket", "bucket", s.cfg.Bucket, "objects", len(objects), "revision", revision)
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "failed to clear content directory")
+	}
+	for key := range objects {
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(key, s.cfg.Prefix), "/")
+		if relativePath == "" || strings.HasSuffix(relativePath, "/") {
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(relativePath))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return errors.Errorf("bucket contains an invalid key: %s", key)
+		}
+		if err := s.downloadObject(key, target); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	s.revision = revision
+	return nil
+}
+
+// Revision returns a hash of the bucket listing which was most recently downloaded
+func (s *S3Source) Revision(dir string) (string, error) {
+	if s.revision == "" {
+		return "", errors.New("bucket has not been fetched")
+	}
+	return s.revision, nil
+}
+
+// listObjects returns the ETag of every object under the configured prefix, keyed by the object key
+func (s *S3Source) listObjects() (map[string]string, error) {
+	objects := map[string]string{}
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.cfg.Prefix != "" {
+			query.Set("prefix", s.cfg.Prefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := s.do(fmt.Sprintf("/%s", s.cfg.Bucket), query)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list bucket")
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode bucket listing")
+		}
+
+		for _, object := range result.Contents {
+			objects[object.Key] = object.ETag
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (s *S3Source) downloadObject(key, target string) error {
+	resp, err := s.do(fmt.Sprintf("/%s/%s", s.cfg.Bucket, key), url.Values{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to download object: %s", key)
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
+
+// do sends a signed GET request for the given path and returns the response if it was successful
+func (s *S3Source) do(path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.cfg.Endpoint+escapePath(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = canonicalQuery(query)
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS signature version 4 to the request. Requests are sent anonymously when
+// no credentials are configured
+func (s *S3Source) sign(req *http.Request, now time.Time) {
+	if s.cfg.AccessKey == "" {
+		return
+	}
+
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.cfg.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// escapePath escapes each segment of the given path as required by AWS signatures
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// escape percent-encodes everything but the characters AWS signatures treat as unreserved:
+// letters, digits, '-', '_', '.' and '~'
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes the query sorted by key as required by AWS signatures
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", escape(key), escape(query.Get(key))))
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package updating
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ContentSource defines a location which content can be fetched from
+type ContentSource interface {
+	// Fetch brings the given directory up to date with the source. If fresh is set, any content
+	// previously fetched into the directory is discarded first
+	Fetch(dir string, fresh bool) error
+	// Revision returns an identifier for the content currently fetched into the given directory
+	Revision(dir string) (string, error)
+}
+
+// LocalSource reads content from a directory on the local filesystem
+type LocalSource struct {
+	path string
+}
+
+// NewLocalSource creates a new source for the given directory
+func NewLocalSource(path string) *LocalSource {
+	return &LocalSource{
+		path: path,
+	}
+}
+
+// Fetch copies the content into the given directory. Nothing is copied if the given directory
+// is the source directory itself
+func (s *LocalSource) Fetch(dir string, fresh bool) error {
+	if s.isPath(dir) {
+		return nil
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "failed to clear content directory")
+	}
+	return copyDir(s.path, dir)
+}
+
+// Revision returns a hash of every file within the given directory
+func (s *LocalSource) Revision(dir string) (string, error) {
+	return hashDir(dir)
+}
+
+// isPath reports whether the given directory is the source directory
+func (s *LocalSource) isPath(dir string) bool {
+	return filepath.Clean(s.path) == filepath.Clean(dir)
+}
+
+// hashDir calculates a hash from the paths and contents of every file within the given directory
+func hashDir(dir string) (string, error) {
+	checksums := []string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		checksum, err := calculateFileChecksum(path)
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		checksums = append(checksums, fmt.Sprintf("%s:%s", filepath.ToSlash(relativePath), checksum))
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to hash content directory")
+	}
+
+	return hashStrings(checksums), nil
+}
+
+// hashStrings returns a revision identifier made from the given values, regardless of their order
+func hashStrings(values []string) string {
+	sort.Strings(values)
+	hash := sha256.New()
+	for _, value := range values {
+		hash.Write([]byte(value))
+		hash.Write([]byte{'\n'})
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:40]
+}
@@ -0,0 +1,207 @@
+package updating_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wamphlett/blog-server/pkg/updating"
+)
+
+func TestArchiveSourceOnlyExtractsChangedArchives(t *testing.T) {
+	archive := tarGz(t, map[string]string{
+		"content-main/topic/README.md":  "# Topic",
+		"content-main/topic/article.md": "# Article",
+	})
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "content")
+	source := updating.NewArchiveSource(server.URL + "/content.tar.gz")
+
+	require.NoError(t, source.Fetch(dir, true))
+	revision, err := source.Revision(dir)
+	require.NoError(t, err)
+	requireFile(t, filepath.Join(dir, "topic", "article.md"), "# Article")
+
+	require.NoError(t, source.Fetch(dir, false))
+	nextRevision, err := source.Revision(dir)
+	require.NoError(t, err)
+	require.Equal(t, revision, nextRevision)
+	require.Equal(t, 1, downloads)
+}
+
+func TestArchiveSourceExtractsZipFromFile(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	f, err := writer.Create("topic/README.md")
+	require.NoError(t, err)
+	f.Write([]byte("# Topic"))
+	require.NoError(t, writer.Close())
+
+	archivePath := filepath.Join(t.TempDir(), "content.zip")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0o644))
+
+	dir := filepath.Join(t.TempDir(), "content")
+	require.NoError(t, updating.NewArchiveSource(archivePath).Fetch(dir, true))
+	requireFile(t, filepath.Join(dir, "topic", "README.md"), "# Topic")
+}
+
+func TestS3SourceDownloadsObjectsUnderPrefix(t *testing.T) {
+	objects := map[string]string{
+		"blog/topic/README.md":  "# Topic",
+		"blog/topic/article.md": "# Article",
+		"blog/topic/notes~1.md": "# Notes",
+	}
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.Header.Get("Authorization"), "Credential=access/")
+		require.NotContains(t, r.URL.EscapedPath(), "%7E")
+
+		if r.URL.Path == "/bucket" {
+			require.Equal(t, "blog/", r.URL.Query().Get("prefix"))
+			fmt.Fprint(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`)
+			for key := range objects {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>"%s"</ETag></Contents>`, key, key)
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+
+		contents, ok := objects[strings.TrimPrefix(r.URL.Path, "/bucket/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		downloads++
+		fmt.Fprint(w, contents)
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "content")
+	source := updating.NewS3Source(updating.S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "bucket",
+		Prefix:    "blog/",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+
+	require.NoError(t, source.Fetch(dir, true))
+	requireFile(t, filepath.Join(dir, "topic", "README.md"), "# Topic")
+	requireFile(t, filepath.Join(dir, "topic", "article.md"), "# Article")
+	requireFile(t, filepath.Join(dir, "topic", "notes~1.md"), "# Notes")
+
+	require.NoError(t, source.Fetch(dir, false))
+	require.Equal(t, 3, downloads)
+}
+
+func TestLocalSourceCopiesContent(t *testing.T) {
+	path := t.TempDir()
+	writeContent(t, path, map[string]string{
+		"topic/README.md": "# Topic",
+		".git/HEAD":       "ref: refs/heads/main",
+	})
+
+	dir := filepath.Join(t.TempDir(), "content")
+	source := updating.NewLocalSource(path)
+	require.NoError(t, source.Fetch(dir, false))
+	requireFile(t, filepath.Join(dir, "topic", "README.md"), "# Topic")
+	require.NoDirExists(t, filepath.Join(dir, ".git"))
+
+	revision, err := source.Revision(dir)
+	require.NoError(t, err)
+
+	// changes to the git directory do not change the revision, changes to the content do
+	writeContent(t, path, map[string]string{".git/HEAD": "ref: refs/heads/other"})
+	sameRevision, err := source.Revision(path)
+	require.NoError(t, err)
+	require.Equal(t, revision, sameRevision)
+
+	writeContent(t, path, map[string]string{"topic/README.md": "# Changed"})
+	require.NoError(t, source.Fetch(dir, false))
+	requireFile(t, filepath.Join(dir, "topic", "README.md"), "# Changed")
+	changedRevision, err := source.Revision(dir)
+	require.NoError(t, err)
+	require.NotEqual(t, revision, changedRevision)
+
+	// fetching into the source directory leaves it untouched
+	require.NoError(t, source.Fetch(path, true))
+	requireFile(t, filepath.Join(path, "topic", "README.md"), "# Changed")
+}
+
+func TestGitSourceClonesAndPullsRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	runGit(t, repo, "init")
+	writeContent(t, repo, map[string]string{"topic/README.md": "# Topic"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-m", "add topic")
+
+	dir := filepath.Join(t.TempDir(), "content")
+	source := updating.NewGitSource(repo)
+	require.NoError(t, source.Fetch(dir, false))
+	requireFile(t, filepath.Join(dir, "topic", "README.md"), "# Topic")
+	revision, err := source.Revision(dir)
+	require.NoError(t, err)
+	require.Equal(t, runGit(t, repo, "rev-parse", "HEAD"), revision)
+
+	writeContent(t, repo, map[string]string{"topic/article.md": "# Article"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-m", "add article")
+
+	require.NoError(t, source.Fetch(dir, false))
+	requireFile(t, filepath.Join(dir, "topic", "article.md"), "# Article")
+	revision, err = source.Revision(dir)
+	require.NoError(t, err)
+	require.Equal(t, runGit(t, repo, "rev-parse", "HEAD"), revision)
+
+	// a fresh fetch discards local changes by cloning again
+	writeContent(t, dir, map[string]string{"topic/README.md": "# Local"})
+	require.NoError(t, source.Fetch(dir, true))
+	requireFile(t, filepath.Join(dir, "topic", "README.md"), "# Topic")
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for name, contents := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err := writer.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func requireFile(t *testing.T, path, contents string) {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, contents, string(b))
+}
@@ -0,0 +1,336 @@
+package updating
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// maxRejectedRevisions limits how many rejected revisions are remembered
+const maxRejectedRevisions = 10
+
+// ErrRejected is returned when a staged revision fails validation
+var ErrRejected = errors.New("content revision failed validation")
+
+// stagingPath returns the directory where content is fetched before it is validated
+func (u *Updater) stagingPath() string {
+	return u.path + ".staging"
+}
+
+// revisionsPath returns the directory which holds a copy of every good revision
+func (u *Updater) revisionsPath() string {
+	return u.path + ".revisions"
+}
+
+// IsStaged reports whether content is fetched into a staging directory and validated before
+// going live. Content read in place from a local directory is not staged
+func (u *Updater) IsStaged() bool {
+	local, ok := u.source.(*LocalSource)
+	return !ok || !local.isPath(u.path)
+}
+
+// fetchIntoStaging fetches the latest content into the staging directory
+func (u *Updater) fetchIntoStaging(ctx context.Context, forceFresh bool) error {
+	// if forcing the update, then remove every revision so that they are fetched again
+	if forceFresh {
+		for _, path := range []string{u.path, u.revisionsPath()} {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return u.fetch(ctx, u.stagingPath(), forceFresh)
+}
+
+// stage validates the content in the staging directory and, if it passes, swaps the content
+// path to point at a copy of it. Revisions which have already been seen are ignored
+func (u *Updater) stage(ctx context.Context) error {
+	revision, err := u.source.Revision(u.stagingPath())
+	if err != nil {
+		return errors.Wrap(err, "failed to read staged revision")
+	}
+
+	if existing := u.findRevision(revision); existing != nil && (existing.Live || existing.Rejected) {
+		return nil
+	}
+	if revision == u.getPinnedRevision() {
+		slog.Info("content has been rolled back, ignoring staged revision", "revision", revision)
+		return nil
+	}
+
+	slog.Info("staging content revision", "revision", revision)
+	revisionPath := filepath.Join(u.revisionsPath(), revision)
+	if err := os.RemoveAll(revisionPath); err != nil {
+		return errors.Wrap(err, "failed to clear revision directory")
+	}
+	if err := copyDir(u.stagingPath(), revisionPath); err != nil {
+		return errors.Wrap(err, "failed to copy staged content")
+	}
+
+	if problems := u.validate(ctx, revisionPath); len(problems) > 0 {
+		if err := os.RemoveAll(revisionPath); err != nil {
+			slog.Error("failed to remove rejected revision", "revision", revision, "error", err)
+		}
+		u.addRevision(&model.ContentRevision{
+			ID:       revision,
+			Source:   u.name,
+			StagedAt: time.Now().Unix(),
+			Rejected: true,
+			Problems: problems,
+		})
+
+		err := errors.Wrapf(ErrRejected, "revision %s has %d problems: %s", revision, len(problems), strings.Join(problems, "; "))
+		sentry.CaptureException(err)
+		return err
+	}
+
+	if err := u.swap(revisionPath); err != nil {
+		return err
+	}
+
+	u.addRevision(&model.ContentRevision{
+		ID:       revision,
+		Source:   u.name,
+		StagedAt: time.Now().Unix(),
+	})
+	u.setLiveRevision(revision)
+	u.setPinnedRevision("")
+	u.pruneRevisions()
+
+	slog.Info("content revision is live", "revision", revision)
+	return nil
+}
+
+// Rollback swaps the content path back to a previously staged revision. The rolled back
+// content stays live until a new revision is fetched
+func (u *Updater) Rollback(revision string) (err error) {
+	u.updateLock.Lock()
+	defer u.updateLock.Unlock()
+
+	ctx, span := tracer.Start(context.Background(), "Updater.Rollback", trace.WithAttributes(
+		attribute.String("source", u.name),
+		attribute.String("revision", revision),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+	defer u.saveState()
+
+	startTime := time.Now()
+	existing := u.findRevision(revision)
+	if existing == nil || existing.Rejected {
+		return errors.Errorf("revision is not available: %s", revision)
+	}
+
+	slog.Info("rolling back content", "revision", revision)
+	if err := u.swap(filepath.Join(u.revisionsPath(), revision)); err != nil {
+		return err
+	}
+	u.setLiveRevision(revision)
+
+	stagedRevision, err := u.source.Revision(u.stagingPath())
+	if err != nil {
+		return errors.Wrap(err, "failed to read staged revision")
+	}
+	if stagedRevision != revision {
+		u.setPinnedRevision(stagedRevision)
+	}
+
+	return u.receive(ctx, startTime)
+}
+
+// GetContentRevisions returns every staged revision, newest first
+func (u *Updater) GetContentRevisions() []*model.ContentRevision {
+	u.revisionLock.RLock()
+	defer u.revisionLock.RUnlock()
+
+	revisions := make([]*model.ContentRevision, len(u.revisions))
+	for i, revision := range u.revisions {
+		copied := *revision
+		revisions[i] = &copied
+	}
+	return revisions
+}
+
+// validate loads the content in the given directory and runs it through the validator
+func (u *Updater) validate(ctx context.Context, path string) []string {
+	if u.validator == nil {
+		return nil
+	}
+
+	topics, articles, err := u.loadContent(ctx, path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return u.validator.Validate(topics, articles)
+}
+
+// swap atomically points the content path at the given directory
+func (u *Updater) swap(revisionPath string) error {
+	target, err := filepath.Abs(revisionPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve revision path")
+	}
+
+	link := u.path + ".next"
+	if err := os.RemoveAll(link); err != nil {
+		return errors.Wrap(err, "failed to clear content link")
+	}
+	if err := os.Symlink(target, link); err != nil {
+		return errors.Wrap(err, "failed to create content link")
+	}
+	if err := os.Rename(link, u.path); err != nil {
+		return errors.Wrap(err, "failed to swap content link")
+	}
+	return nil
+}
+
+func (u *Updater) findRevision(id string) *model.ContentRevision {
+	u.revisionLock.RLock()
+	defer u.revisionLock.RUnlock()
+
+	for _, revision := range u.revisions {
+		if revision.ID == id {
+			return revision
+		}
+	}
+	return nil
+}
+
+func (u *Updater) addRevision(revision *model.ContentRevision) {
+	u.revisionLock.Lock()
+	defer u.revisionLock.Unlock()
+
+	revisions := []*model.ContentRevision{revision}
+	for _, existing := range u.revisions {
+		if existing.ID != revision.ID {
+			revisions = append(revisions, existing)
+		}
+	}
+	u.revisions = revisions
+}
+
+func (u *Updater) liveRevision() string {
+	u.revisionLock.RLock()
+	defer u.revisionLock.RUnlock()
+
+	for _, revision := range u.revisions {
+		if revision.Live {
+			return revision.ID
+		}
+	}
+	return "HEAD"
+}
+
+func (u *Updater) setLiveRevision(id string) {
+	u.revisionLock.Lock()
+	defer u.revisionLock.Unlock()
+
+	for _, revision := range u.revisions {
+		revision.Live = revision.ID == id
+	}
+}
+
+func (u *Updater) getPinnedRevision() string {
+	u.revisionLock.RLock()
+	defer u.revisionLock.RUnlock()
+
+	return u.pinnedRevision
+}
+
+func (u *Updater) setPinnedRevision(id string) {
+	u.revisionLock.Lock()
+	defer u.revisionLock.Unlock()
+
+	u.pinnedRevision = id
+}
+
+// pruneRevisions removes the good revisions beyond the number to keep, along with any
+// old rejected revisions. The live revision is always kept
+func (u *Updater) pruneRevisions() {
+	u.revisionLock.Lock()
+	defer u.revisionLock.Unlock()
+
+	kept := []*model.ContentRevision{}
+	good, rejected := 0, 0
+	for _, revision := range u.revisions {
+		if revision.Rejected {
+			if rejected < maxRejectedRevisions {
+				kept = append(kept, revision)
+			}
+			rejected++
+			continue
+		}
+
+		if revision.Live || good < u.revisionsToKeep {
+			kept = append(kept, revision)
+			good++
+			continue
+		}
+
+		slog.Info("removing old content revision", "revision", revision.ID)
+		if err := os.RemoveAll(filepath.Join(u.revisionsPath(), revision.ID)); err != nil {
+			slog.Error("failed to remove old content revision", "revision", revision.ID, "error", err)
+		}
+	}
+	u.revisions = kept
+}
+
+// copyDir copies the files from the source directory into the destination, ignoring
+// any git metadata
+func copyDir(source, destination string) error {
+	return filepath.WalkDir(source, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if entry.Name() == ".git" {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		target := filepath.Join(destination, relativePath)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
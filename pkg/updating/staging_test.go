@@ -0,0 +1,173 @@
+package updating_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/updating"
+)
+
+// stubValidator rejects any article which contains the word "broken"
+type stubValidator struct{}
+
+func (stubValidator) Validate(topics []*model.Topic, articles []*model.Article) []string {
+	problems := []string{}
+	for _, article := range articles {
+		contents, err := os.ReadFile(article.FilePath)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if strings.Contains(string(contents), "broken") {
+			problems = append(problems, article.Slug+" is broken")
+		}
+	}
+	return problems
+}
+
+func writeContent(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(contents), 0o644))
+	}
+}
+
+func liveRevision(revisions []*model.ContentRevision) string {
+	for _, revision := range revisions {
+		if revision.Live {
+			return revision.ID
+		}
+	}
+	return ""
+}
+
+func TestStagesContentRevisions(t *testing.T) {
+	source, content := t.TempDir(), filepath.Join(t.TempDir(), "content")
+	writeContent(t, source, map[string]string{"topic/README.md": "# Topic", "topic/one.md": "# One"})
+
+	received, deleted := []string{}, []string{}
+	u, err := updating.New(content, "README.md", stubReader{}, noopMetrics{},
+		updating.WithSource(updating.NewLocalSource(source)),
+		updating.WithValidator(stubValidator{}),
+		updating.WithReceiver(func(changes *model.ContentChanges) {
+			for _, article := range changes.Articles {
+				received = append(received, article.Slug)
+			}
+			for _, article := range changes.DeletedArticles {
+				deleted = append(deleted, article.Slug)
+			}
+		}),
+	)
+	require.NoError(t, err)
+	require.True(t, u.IsStaged())
+	require.Equal(t, []string{"one"}, received)
+
+	// the content path is swapped to a copy of the good revision
+	revisions := u.GetContentRevisions()
+	require.Len(t, revisions, 1)
+	first := revisions[0].ID
+	require.True(t, revisions[0].Live)
+	target, err := os.Readlink(content)
+	require.NoError(t, err)
+	require.Equal(t, first, filepath.Base(target))
+
+	// a revision which fails validation never goes live
+	received = []string{}
+	writeContent(t, source, map[string]string{"topic/two.md": "# Two is broken"})
+	err = u.Update(false)
+	require.ErrorIs(t, err, updating.ErrRejected)
+	require.Empty(t, received)
+	revisions = u.GetContentRevisions()
+	require.Len(t, revisions, 2)
+	require.True(t, revisions[0].Rejected)
+	require.Equal(t, []string{"two is broken"}, revisions[0].Problems)
+	require.Equal(t, first, liveRevision(revisions))
+	require.NoFileExists(t, filepath.Join(content, "topic", "two.md"))
+
+	// the rejected revision is not staged again
+	require.NoError(t, u.Update(false))
+
+	// fixing the content makes it live
+	writeContent(t, source, map[string]string{"topic/two.md": "# Two"})
+	require.NoError(t, u.Update(false))
+	require.Equal(t, []string{"two"}, received)
+	revisions = u.GetContentRevisions()
+	second := revisions[0].ID
+	require.Equal(t, second, liveRevision(revisions))
+	require.FileExists(t, filepath.Join(content, "topic", "two.md"))
+
+	// rolling back stays in place until a new revision is fetched
+	require.NoError(t, u.Rollback(first))
+	require.Equal(t, []string{"two"}, deleted)
+	require.Equal(t, first, liveRevision(u.GetContentRevisions()))
+	require.NoError(t, u.Update(false))
+	require.Equal(t, first, liveRevision(u.GetContentRevisions()))
+	require.NoFileExists(t, filepath.Join(content, "topic", "two.md"))
+
+	writeContent(t, source, map[string]string{"topic/three.md": "# Three"})
+	require.NoError(t, u.Update(false))
+	require.FileExists(t, filepath.Join(content, "topic", "three.md"))
+
+	// rejected revisions cannot be rolled back to
+	require.Error(t, u.Rollback(revisions[1].ID))
+	require.Error(t, u.Rollback("unknown"))
+}
+
+func TestServesNothingUntilContentPassesValidation(t *testing.T) {
+	source, content := t.TempDir(), filepath.Join(t.TempDir(), "content")
+	writeContent(t, source, map[string]string{"topic/README.md": "# Topic", "topic/one.md": "# One is broken"})
+
+	received := []string{}
+	u, err := updating.New(content, "README.md", stubReader{}, noopMetrics{},
+		updating.WithSource(updating.NewLocalSource(source)),
+		updating.WithValidator(stubValidator{}),
+		updating.WithReceiver(func(changes *model.ContentChanges) {
+			for _, article := range changes.Articles {
+				received = append(received, article.Slug)
+			}
+		}),
+	)
+	require.NoError(t, err)
+	require.Empty(t, received)
+	require.NoFileExists(t, content)
+	require.Empty(t, liveRevision(u.GetContentRevisions()))
+
+	writeContent(t, source, map[string]string{"topic/one.md": "# One"})
+	require.NoError(t, u.Update(false))
+	require.Equal(t, []string{"one"}, received)
+	require.NotEmpty(t, liveRevision(u.GetContentRevisions()))
+}
+
+func TestPrunesOldRevisions(t *testing.T) {
+	source, content := t.TempDir(), filepath.Join(t.TempDir(), "content")
+	writeContent(t, source, map[string]string{"topic/README.md": "# Topic", "topic/one.md": "# One"})
+
+	u, err := updating.New(content, "README.md", stubReader{}, noopMetrics{},
+		updating.WithSource(updating.NewLocalSource(source)),
+		updating.WithRevisionsToKeep(2),
+	)
+	require.NoError(t, err)
+
+	for _, contents := range []string{"# Two", "# Three", "# Four"} {
+		writeContent(t, source, map[string]string{"topic/one.md": contents})
+		require.NoError(t, u.Update(false))
+	}
+
+	revisions := u.GetContentRevisions()
+	require.Len(t, revisions, 2)
+	require.True(t, revisions[0].Live)
+
+	entries, err := os.ReadDir(content + ".revisions")
+	require.NoError(t, err)
+	kept := []string{}
+	for _, entry := range entries {
+		kept = append(kept, entry.Name())
+	}
+	require.ElementsMatch(t, []string{revisions[0].ID, revisions[1].ID}, kept)
+}
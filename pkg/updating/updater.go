@@ -1,26 +1,40 @@
 package updating
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"log/slog"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/wamphlett/blog-server/pkg/model"
 )
 
-type Database interface {
-	SetTopics(topic *model.Topic) error
-	SetArticle(article *model.Article) error
-}
+var tracer = otel.Tracer("github.com/wamphlett/blog-server/pkg/updating")
+
+// Receiver is called with the changes found by every update. The first update after starting
+// afresh finds every topic and article
+type Receiver func(changes *model.ContentChanges)
 
-type Receiver func(topic []*model.Topic, article []*model.Article)
+// Store defines where the updater's state is kept between restarts
+type Store interface {
+	GetUpdaterState(source string) (*model.UpdaterState, error)
+	StoreUpdaterState(source string, state *model.UpdaterState) error
+}
 
 // Metrics defines the metrics used by the updater
 type Metrics interface {
@@ -28,26 +42,45 @@ type Metrics interface {
 }
 
 type Reader interface {
-	LoadTopicFromFile(topicFilePath string) *model.Topic
-	LoadArticleFromFile(articleFilePath, topicSlug string) *model.Article
+	LoadTopicFromFile(ctx context.Context, topicFilePath, parentSlug string) *model.Topic
+	LoadArticleFromFile(ctx context.Context, articleFilePath, topicSlug string) *model.Article
+}
+
+// Validator defines the methods required to validate content before it goes live
+type Validator interface {
+	Validate(topics []*model.Topic, articles []*model.Article) []string
 }
 
 // Updater defines a new updater
 type Updater struct {
+	name      string
 	path      string
 	topicFile string
-	repo      string
+	source    ContentSource
 
-	metrics Metrics
-	reader  Reader
+	metrics   Metrics
+	reader    Reader
+	validator Validator
 
 	callbacks []func()
 
 	receivers []Receiver
 
-	refreshInterval time.Duration
-
 	fileChecksums map[string]string
+	// fileSlugs holds the slug each file was last read as, "<topic>/<article>" for articles
+	fileSlugs map[string]string
+
+	// store is nil when the state is not kept between restarts
+	store Store
+
+	// updateLock ensures only one update or rollback runs at a time
+	updateLock sync.Mutex
+
+	// revisions holds the staged content revisions, newest first
+	revisions       []*model.ContentRevision
+	revisionsToKeep int
+	pinnedRevision  string
+	revisionLock    sync.RWMutex
 }
 
 // Option defines the function used to set options
@@ -60,15 +93,45 @@ func WithCallback(function func()) Option {
 	}
 }
 
+// WithName specifies the name of the source, which is set on every topic and article it provides
+func WithName(name string) Option {
+	return func(u *Updater) {
+		u.name = name
+	}
+}
+
+// WithSource specifies where the content is fetched from. By default, the content is read in place
+// from the content path
+func WithSource(source ContentSource) Option {
+	return func(u *Updater) {
+		u.source = source
+	}
+}
+
+// WithRemoteRepository fetches the content from the given remote git repository
 func WithRemoteRepository(repo string) Option {
+	return WithSource(NewGitSource(repo))
+}
+
+// WithValidator specifies a validator which staged content must pass before going live
+func WithValidator(validator Validator) Option {
+	return func(u *Updater) {
+		u.validator = validator
+	}
+}
+
+// WithRevisionsToKeep specifies how many good content revisions are kept for rolling back to
+func WithRevisionsToKeep(revisionsToKeep int) Option {
 	return func(u *Updater) {
-		u.repo = repo
+		u.revisionsToKeep = revisionsToKeep
 	}
 }
 
-func WithRefreshInterval(refreshInterval time.Duration) Option {
+// WithStore keeps the file checksums and staged revisions in the given store, so that after a
+// restart only the content which has changed since is passed to the receivers
+func WithStore(store Store) Option {
 	return func(u *Updater) {
-		u.refreshInterval = refreshInterval
+		u.store = store
 	}
 }
 
@@ -83,12 +146,13 @@ func New(contentPath, topicFile string, reader Reader, metrics Metrics, opts ...
 	u := &Updater{
 		path:      contentPath,
 		topicFile: topicFile,
+		source:    NewLocalSource(contentPath),
 		metrics:   metrics,
 		reader:    reader,
 		callbacks: []func(){},
 
 		receivers:       []Receiver{},
-		refreshInterval: 5 * time.Minute,
+		revisionsToKeep: 3,
 	}
 
 	// apply the options
@@ -96,136 +160,389 @@ func New(contentPath, topicFile string, reader Reader, metrics Metrics, opts ...
 		opt(u)
 	}
 
-	// update immediately
-	if err := u.Update(true); err != nil {
+	// carry on from the previous state if there is one, otherwise start afresh
+	warm, err := u.loadState()
+	if err != nil {
 		return nil, err
 	}
-	// schedule further updates on the defined interval
-	go scheduleUpdates(u.refreshInterval, func() {
-		if err := u.Update(false); err != nil {
-			slog.Error("error when updating content", "error", err)
-		}
-		for _, callback := range u.callbacks {
-			callback()
-		}
-	})
 
-	slog.Info("updater configured to refresh content", "interval_seconds", u.refreshInterval.Seconds())
+	// update immediately. Rejected content is not fatal, as nothing is served from the source
+	// until a revision which passes validation is fetched
+	if err := u.Update(!warm); errors.Is(err, ErrRejected) {
+		slog.Error("content failed validation, nothing is served from the source until it is fixed", "source", u.name, "error", err)
+	} else if err != nil {
+		return nil, err
+	}
 
 	return u, nil
 }
 
-// Update updates the content from the remote repository
-func (u *Updater) Update(forceFresh bool) error {
+// Poll fetches any changes from the source and then runs the callbacks. It is intended to be
+// run on a schedule
+func (u *Updater) Poll() error {
+	err := u.Update(false)
+	if err != nil {
+		slog.Error("error when updating content", "source", u.name, "error", err)
+	}
+	for _, callback := range u.callbacks {
+		callback()
+	}
+	return err
+}
+
+// Update fetches the latest content from the source
+func (u *Updater) Update(forceFresh bool) (err error) {
+	u.updateLock.Lock()
+	defer u.updateLock.Unlock()
+
+	ctx, span := tracer.Start(context.Background(), "Updater.Update", trace.WithAttributes(
+		attribute.String("source", u.name),
+		attribute.Bool("force_fresh", forceFresh),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+	defer u.saveState()
+
 	startTime := time.Now()
 	slog.Info("updating content", "force_fresh", forceFresh)
 	defer u.metrics.ContentUpdated(startTime)
 
-	if u.repo != "" {
-		if err := u.updateFromRemote(forceFresh); err != nil {
-			slog.Error("failed to update from remote", "error", err)
+	if !u.IsStaged() {
+		if err := u.fetch(ctx, u.path, forceFresh); err != nil {
+			slog.Error("failed to fetch content", "error", err)
 			return err
 		}
+		return u.receive(ctx, startTime)
+	}
+
+	if err := u.fetchIntoStaging(ctx, forceFresh); err != nil {
+		slog.Error("failed to fetch content", "error", err)
+		return err
+	}
+
+	if err := u.stage(ctx); err != nil {
+		slog.Error("failed to stage content", "error", err)
+		return err
+	}
+
+	// every revision fetched so far has been rejected
+	if _, err := os.Stat(u.path); os.IsNotExist(err) {
+		slog.Warn("no content revision is live", "source", u.name)
+		return nil
+	}
+
+	return u.receive(ctx, startTime)
+}
+
+// loadState restores the state saved by a previous run. The state is only used if the content
+// it describes is still on disk, in which case true is returned
+func (u *Updater) loadState() (bool, error) {
+	if u.store == nil {
+		return false, nil
+	}
+
+	state, err := u.store.GetUpdaterState(u.name)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to load updater state")
+	}
+	if state == nil || len(state.Checksums) == 0 {
+		return false, nil
+	}
+	if _, err := os.Stat(u.path); err != nil {
+		// everything is read again, but anything which has since been deleted is still found
+		slog.Info("content is no longer on disk, starting afresh", "path", u.path)
+		u.fileSlugs = state.Slugs
+		return false, nil
+	}
+
+	// revisions which are no longer on disk cannot be rolled back to
+	revisions := []*model.ContentRevision{}
+	for _, revision := range state.Revisions {
+		if !revision.Rejected {
+			if _, err := os.Stat(filepath.Join(u.revisionsPath(), revision.ID)); err != nil {
+				continue
+			}
+		}
+		revisions = append(revisions, revision)
+	}
+
+	u.fileChecksums = state.Checksums
+	u.fileSlugs = state.Slugs
+	u.revisionLock.Lock()
+	u.revisions = revisions
+	u.pinnedRevision = state.PinnedRevision
+	u.revisionLock.Unlock()
+
+	slog.Info("restored updater state", "source", u.name, "files", len(state.Checksums), "revisions", len(revisions))
+	return true, nil
+}
+
+// saveState stores the checksums and revisions so they survive a restart
+func (u *Updater) saveState() {
+	if u.store == nil {
+		return
 	}
 
-	topics, articles, err := u.readFiles()
+	u.revisionLock.RLock()
+	state := &model.UpdaterState{
+		Checksums:      u.fileChecksums,
+		Slugs:          u.fileSlugs,
+		Revisions:      u.revisions,
+		PinnedRevision: u.pinnedRevision,
+	}
+	err := u.store.StoreUpdaterState(u.name, state)
+	u.revisionLock.RUnlock()
+	if err != nil {
+		slog.Error("failed to store updater state", "source", u.name, "error", err)
+		sentry.CaptureException(err)
+	}
+}
+
+// fetch fetches the latest content from the source into the given directory
+func (u *Updater) fetch(ctx context.Context, path string, forceFresh bool) error {
+	_, span := tracer.Start(ctx, "ContentSource.Fetch")
+	err := u.source.Fetch(path, forceFresh)
+	endSpan(span, err)
+	return err
+}
+
+// receive reads the live content and passes anything which has changed to the receivers
+func (u *Updater) receive(ctx context.Context, startTime time.Time) error {
+	changes, err := u.readFiles(ctx)
 	if err != nil {
 		return err
 	}
 
-	slog.Info("content update complete", "changed_topics", len(topics), "changed_articles", len(articles), "duration", time.Since(startTime))
+	slog.Info("content update complete",
+		"changed_topics", len(changes.Topics),
+		"changed_articles", len(changes.Articles),
+		"deleted_topics", len(changes.DeletedTopics),
+		"deleted_articles", len(changes.DeletedArticles),
+		"duration", time.Since(startTime),
+	)
 
 	for _, receiver := range u.receivers {
-		receiver(topics, articles)
+		receiver(changes)
 	}
 
 	return nil
 }
 
-func (u *Updater) readFiles() ([]*model.Topic, []*model.Article, error) {
-	// read the main content directory to look for topic directories
-	files, err := os.ReadDir(u.path)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to read content directory")
-	}
+// readFiles reads every file which has changed since the last update, along with finding any
+// topics and articles which have been deleted or have moved to a different slug
+func (u *Updater) readFiles(ctx context.Context) (*model.ContentChanges, error) {
+	ctx, span := tracer.Start(ctx, "Updater.readFiles")
+	defer span.End()
 
+	changes := &model.ContentChanges{}
 	newChecksums := map[string]string{}
-	defer func() {
-		u.fileChecksums = newChecksums
-	}()
-
+	newSlugs := map[string]string{}
 	topics := []*model.Topic{}
-	articles := []*model.Article{}
+	changedTopics := map[*model.Topic]bool{}
 
-	for _, file := range files {
-		if !file.IsDir() {
-			continue
+	err := u.walkContent(u.path, "", func(topicFilePath, parentSlug string, articleFilePaths []string) string {
+		topic := u.loadTopic(ctx, topicFilePath, parentSlug)
+		if topic == nil {
+			return ""
 		}
-		topicFilePath := filepath.Join(u.path, file.Name(), u.topicFile)
-		if _, err := os.Stat(topicFilePath); os.IsNotExist(err) {
-			continue
-		}
-
-		topic := u.reader.LoadTopicFromFile(topicFilePath)
+		topics = append(topics, topic)
 
 		// check if the file has changed
-		checksum, err := u.calculateFileChecksum(topicFilePath)
+		checksum, err := calculateFileChecksum(topicFilePath)
 		if err != nil {
 			slog.Error("failed to calculate topic checksum", "path", topicFilePath, "error", err)
 			sentry.CaptureException(errors.Wrap(err, "failed to calculate topic checksum when updating"))
 		}
 
+		// an unchanged subtopic is read again if its parent has moved to a different slug
 		previousChecksum, ok := u.fileChecksums[topicFilePath]
-		if !ok || checksum != previousChecksum {
+		if !ok || checksum != previousChecksum || u.fileSlugs[topicFilePath] != topic.Slug {
 			// there have been changes to this file
-			topics = append(topics, topic)
+			changedTopics[topic] = true
 		}
 
-		// store the checksum for the next update
+		// store the checksum and slug for the next update
 		newChecksums[topicFilePath] = checksum
+		newSlugs[topicFilePath] = topic.Slug
 
-		articleFiles, err := os.ReadDir(filepath.Dir(topicFilePath))
-		if err != nil {
-			return nil, nil, errors.Wrap(err, "failed to read topic content directory")
-		}
-
-		for _, file := range articleFiles {
-			if file.IsDir() || file.Name() == filepath.Base(topicFilePath) || filepath.Ext(file.Name()) != ".md" {
-				continue
-			}
-
-			articleFilepath := filepath.Join(filepath.Dir(topicFilePath), file.Name())
-
+		for _, articleFilepath := range articleFilePaths {
 			// check if the file has changed
-			checksum, err := u.calculateFileChecksum(articleFilepath)
+			checksum, err := calculateFileChecksum(articleFilepath)
 			if err != nil {
 				slog.Error("failed to calculate article checksum", "path", articleFilepath, "error", err)
 				sentry.CaptureException(errors.Wrap(err, "failed to calculate article checksum when updating"))
 			}
 
+			// an unchanged article is read again if its topic has moved to a different slug
 			previousChecksum, ok := u.fileChecksums[articleFilepath]
-			if !ok || checksum != previousChecksum {
+			previousSlug := u.fileSlugs[articleFilepath]
+			previousTopicSlug, _ := splitArticleSlug(previousSlug)
+			if !ok || checksum != previousChecksum || previousTopicSlug != topic.Slug {
 				// there have been changes to this file
-				article := u.reader.LoadArticleFromFile(articleFilepath, topic.Slug)
-				articles = append(articles, article)
+				article := u.loadArticle(ctx, articleFilepath, topic.Slug)
+				changes.Articles = append(changes.Articles, article)
+				newSlugs[articleFilepath] = topic.Slug + "/" + article.Slug
+			} else {
+				newSlugs[articleFilepath] = previousSlug
 			}
 
 			// store the checksum for the next update
 			newChecksums[articleFilepath] = checksum
 		}
+
+		return topic.Slug
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// topics are changed when a subtopic is added or removed, as they list their children
+	linkSubtopics(topics)
+	previousChildren := map[string][]string{}
+	for path, slug := range u.fileSlugs {
+		if filepath.Base(path) == u.topicFile && strings.Contains(slug, "/") {
+			parentSlug := slug[:strings.LastIndex(slug, "/")]
+			previousChildren[parentSlug] = append(previousChildren[parentSlug], slug)
+		}
+	}
+	for _, topic := range topics {
+		sort.Strings(previousChildren[topic.Slug])
+		if changedTopics[topic] || strings.Join(previousChildren[topic.Slug], ",") != strings.Join(topic.Children, ",") {
+			changes.Topics = append(changes.Topics, topic)
+		}
 	}
 
-	return topics, articles, nil
+	// anything which is no longer found under the same slug has been deleted
+	for path, slug := range u.fileSlugs {
+		if newSlugs[path] == slug {
+			continue
+		}
+		if filepath.Base(path) == u.topicFile {
+			changes.DeletedTopics = append(changes.DeletedTopics, &model.Topic{Slug: slug, Source: u.name, FilePath: path})
+		} else {
+			topicSlug, articleSlug := splitArticleSlug(slug)
+			changes.DeletedArticles = append(changes.DeletedArticles, &model.Article{Slug: articleSlug, TopicSlug: topicSlug, Source: u.name, FilePath: path})
+		}
+	}
+
+	u.fileChecksums = newChecksums
+	u.fileSlugs = newSlugs
+
+	return changes, nil
 }
 
-// scheduleUpdates start a new ticker to update the content on the given interval
-func scheduleUpdates(interval time.Duration, f func()) {
-	for range time.Tick(interval) {
-		f()
+// loadContent reads every topic and article within the given directory
+func (u *Updater) loadContent(ctx context.Context, root string) ([]*model.Topic, []*model.Article, error) {
+	topics := []*model.Topic{}
+	articles := []*model.Article{}
+
+	err := u.walkContent(root, "", func(topicFilePath, parentSlug string, articleFilePaths []string) string {
+		topic := u.loadTopic(ctx, topicFilePath, parentSlug)
+		if topic == nil {
+			return ""
+		}
+		topics = append(topics, topic)
+
+		for _, articleFilePath := range articleFilePaths {
+			articles = append(articles, u.loadArticle(ctx, articleFilePath, topic.Slug))
+		}
+
+		return topic.Slug
+	})
+	linkSubtopics(topics)
+
+	return topics, articles, err
+}
+
+// loadTopic reads the given topic file. Subtopics with a reserved slug could never be reached
+// through the API, so they are logged and nil is returned
+func (u *Updater) loadTopic(ctx context.Context, topicFilePath, parentSlug string) *model.Topic {
+	topic := u.reader.LoadTopicFromFile(ctx, topicFilePath, parentSlug)
+	if topic.HasReservedSlug() {
+		slog.Error("ignoring subtopic with a reserved slug", "slug", topic.Slug, "path", topicFilePath, "reserved", model.ReservedSubtopicSlugs)
+		return nil
 	}
+	topic.Source = u.name
+	return topic
+}
+
+func (u *Updater) loadArticle(ctx context.Context, articleFilePath, topicSlug string) *model.Article {
+	article := u.reader.LoadArticleFromFile(ctx, articleFilePath, topicSlug)
+	article.Source = u.name
+	return article
 }
 
-func (u *Updater) calculateFileChecksum(filePath string) (string, error) {
+// walkContent calls the given function with every topic file found in the given directory
+// along with the article files which belong to the topic. Directories within a topic which
+// have a topic file are subtopics, which are walked after their parent with the slug the
+// function returned for it. If the function returns an empty slug, the subtopics are skipped
+func (u *Updater) walkContent(dir, parentSlug string, f func(topicFilePath, parentSlug string, articleFilePaths []string) string) error {
+	// read the directory to look for topic directories
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read content directory")
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		topicFilePath := filepath.Join(dir, file.Name(), u.topicFile)
+		if _, err := os.Stat(topicFilePath); os.IsNotExist(err) {
+			continue
+		}
+
+		articleFiles, err := os.ReadDir(filepath.Dir(topicFilePath))
+		if err != nil {
+			return errors.Wrap(err, "failed to read topic content directory")
+		}
+
+		articleFilePaths := []string{}
+		for _, file := range articleFiles {
+			if file.IsDir() || file.Name() == filepath.Base(topicFilePath) || filepath.Ext(file.Name()) != ".md" {
+				continue
+			}
+
+			articleFilePaths = append(articleFilePaths, filepath.Join(filepath.Dir(topicFilePath), file.Name()))
+		}
+
+		topicSlug := f(topicFilePath, parentSlug, articleFilePaths)
+		if topicSlug == "" {
+			continue
+		}
+		if err := u.walkContent(filepath.Dir(topicFilePath), topicSlug, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkSubtopics sets the children of every topic from the topics nested within it
+func linkSubtopics(topics []*model.Topic) {
+	children := map[string][]string{}
+	for _, topic := range topics {
+		if topic.ParentSlug != "" {
+			children[topic.ParentSlug] = append(children[topic.ParentSlug], topic.Slug)
+		}
+	}
+	for _, topic := range topics {
+		topic.Children = children[topic.Slug]
+		sort.Strings(topic.Children)
+	}
+}
+
+// splitArticleSlug splits a "<topic>/<article>" slug, where the topic may itself be nested
+func splitArticleSlug(slug string) (topicSlug, articleSlug string) {
+	i := strings.LastIndex(slug, "/")
+	if i < 0 {
+		return "", slug
+	}
+	return slug[:i], slug[i+1:]
+}
+
+func calculateFileChecksum(filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
@@ -239,3 +556,12 @@ func (u *Updater) calculateFileChecksum(filePath string) (string, error) {
 
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
+
+// endSpan ends the span, marking it as failed if there was an error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,124 @@
+package updating_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	memorydatabase "github.com/wamphlett/blog-server/pkg/memoryDatabase"
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/updating"
+)
+
+type stubReader struct{}
+
+func (stubReader) LoadTopicFromFile(ctx context.Context, topicFilePath, parentSlug string) *model.Topic {
+	slug := filepath.Base(filepath.Dir(topicFilePath))
+	if parentSlug != "" {
+		slug = parentSlug + "/" + slug
+	}
+	return &model.Topic{Slug: slug, ParentSlug: parentSlug, FilePath: topicFilePath}
+}
+
+func (stubReader) LoadArticleFromFile(ctx context.Context, articleFilePath, topicSlug string) *model.Article {
+	return &model.Article{Slug: strings.TrimSuffix(filepath.Base(articleFilePath), ".md"), TopicSlug: topicSlug, FilePath: articleFilePath}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ContentUpdated(startTime time.Time) {}
+
+func TestOnlyReceivesChangesAfterARestart(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "topic"), 0o755))
+	for name, contents := range map[string]string{"README.md": "# Topic", "one.md": "# One", "two.md": "# Two"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "topic", name), []byte(contents), 0o644))
+	}
+
+	store := memorydatabase.New()
+	received := []string{}
+	deleted := []string{}
+	receiver := updating.WithReceiver(func(changes *model.ContentChanges) {
+		for _, topic := range changes.Topics {
+			received = append(received, topic.Slug)
+		}
+		for _, article := range changes.Articles {
+			received = append(received, article.Slug)
+		}
+		for _, article := range changes.DeletedArticles {
+			deleted = append(deleted, article.TopicSlug+"/"+article.Slug)
+		}
+	})
+
+	_, err := updating.New(dir, "README.md", stubReader{}, noopMetrics{}, updating.WithStore(store), receiver)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"topic", "one", "two"}, received)
+
+	// change and delete files while the server is down
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "topic", "two.md"), []byte("# Two, again"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "topic", "one.md")))
+
+	received = []string{}
+	_, err = updating.New(dir, "README.md", stubReader{}, noopMetrics{}, updating.WithStore(store), receiver)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, received)
+	require.Equal(t, []string{"topic/one"}, deleted)
+}
+
+func TestReadsNestedTopics(t *testing.T) {
+	dir := t.TempDir()
+	for path, contents := range map[string]string{
+		"guides/README.md":               "# Guides",
+		"guides/intro.md":                "# Intro",
+		"guides/go/README.md":            "# Go",
+		"guides/go/setup.md":             "# Setup",
+		"guides/go/testing/README.md":    "# Testing",
+		"guides/images/ignored/notes.md": "# Not a topic",
+		"guides/articles/README.md":      "# Reserved",
+		"guides/articles/hidden.md":      "# Hidden",
+		"guides/articles/deep/README.md": "# Deep",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(contents), 0o644))
+	}
+
+	store := memorydatabase.New()
+	var received *model.ContentChanges
+	receiver := updating.WithReceiver(func(changes *model.ContentChanges) {
+		received = changes
+	})
+
+	_, err := updating.New(dir, "README.md", stubReader{}, noopMetrics{}, updating.WithStore(store), receiver)
+	require.NoError(t, err)
+
+	topics := map[string]*model.Topic{}
+	for _, topic := range received.Topics {
+		topics[topic.Slug] = topic
+	}
+	// subtopics with a reserved slug are ignored along with everything within them
+	require.Len(t, topics, 3)
+	require.Equal(t, []string{"guides/go"}, topics["guides"].Children)
+	require.Equal(t, "guides/go", topics["guides/go/testing"].ParentSlug)
+	require.Empty(t, topics["guides/go/testing"].Children)
+
+	articles := []string{}
+	for _, article := range received.Articles {
+		articles = append(articles, article.TopicSlug+"/"+article.Slug)
+	}
+	require.ElementsMatch(t, []string{"guides/intro", "guides/go/setup"}, articles)
+
+	// removing a subtopic changes its parent, as it lists its children
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "guides", "go", "testing")))
+	_, err = updating.New(dir, "README.md", stubReader{}, noopMetrics{}, updating.WithStore(store), receiver)
+	require.NoError(t, err)
+	require.Len(t, received.Topics, 1)
+	require.Equal(t, "guides/go", received.Topics[0].Slug)
+	require.Len(t, received.DeletedTopics, 1)
+	require.Equal(t, "guides/go/testing", received.DeletedTopics[0].Slug)
+	require.Empty(t, received.Articles)
+}
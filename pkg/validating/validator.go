@@ -0,0 +1,135 @@
+package validating
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+)
+
+// Reader defines the methods required by the reader
+type Reader interface {
+	CheckFileHeaders(path string) []error
+	GetRelativeLinks(path string) ([]string, error)
+}
+
+// Validator checks a set of content before it is allowed to go live
+type Validator struct {
+	reader         Reader
+	maxBrokenLinks int
+}
+
+// Option defines the function used to set options
+type Option func(*Validator)
+
+// WithMaxBrokenLinks specifies how many broken relative links are tolerated before
+// the content is rejected
+func WithMaxBrokenLinks(maxBrokenLinks int) Option {
+	return func(v *Validator) {
+		v.maxBrokenLinks = maxBrokenLinks
+	}
+}
+
+// New creates a new validator with the required dependencies
+func New(reader Reader, opts ...Option) *Validator {
+	v := &Validator{
+		reader: reader,
+	}
+
+	// apply the options
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+// Validate runs every validation rule against the given content and returns the problems
+// found. The content is valid when no problems are returned
+func (v *Validator) Validate(topics []*model.Topic, articles []*model.Article) []string {
+	problems := []string{}
+	problems = append(problems, v.checkHeaders(topics, articles)...)
+	problems = append(problems, v.checkSlugCollisions(topics, articles)...)
+	problems = append(problems, v.checkBrokenLinks(topics, articles)...)
+
+	if len(problems) > 0 {
+		slog.Warn("content failed validation", "problems", len(problems))
+	}
+	return problems
+}
+
+// checkHeaders ensures the headers of every file can be parsed
+func (v *Validator) checkHeaders(topics []*model.Topic, articles []*model.Article) []string {
+	problems := []string{}
+	for _, path := range filePaths(topics, articles) {
+		for _, err := range v.reader.CheckFileHeaders(path) {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// checkSlugCollisions ensures topics and the articles within each topic have unique slugs
+func (v *Validator) checkSlugCollisions(topics []*model.Topic, articles []*model.Article) []string {
+	problems := []string{}
+
+	topicPaths := map[string]string{}
+	for _, topic := range topics {
+		if existing, ok := topicPaths[topic.Slug]; ok {
+			problems = append(problems, fmt.Sprintf("topic slug %q is used by both %s and %s", topic.Slug, existing, topic.FilePath))
+			continue
+		}
+		topicPaths[topic.Slug] = topic.FilePath
+	}
+
+	articlePaths := map[string]string{}
+	for _, article := range articles {
+		key := fmt.Sprintf("%s/%s", article.TopicSlug, article.Slug)
+		if existing, ok := articlePaths[key]; ok {
+			problems = append(problems, fmt.Sprintf("article slug %q is used by both %s and %s", key, existing, article.FilePath))
+			continue
+		}
+		articlePaths[key] = article.FilePath
+	}
+
+	return problems
+}
+
+// checkBrokenLinks ensures the number of relative links pointing at missing files is within
+// the configured threshold
+func (v *Validator) checkBrokenLinks(topics []*model.Topic, articles []*model.Article) []string {
+	brokenLinks := []string{}
+	for _, path := range filePaths(topics, articles) {
+		links, err := v.reader.GetRelativeLinks(path)
+		if err != nil {
+			brokenLinks = append(brokenLinks, err.Error())
+			continue
+		}
+
+		for _, link := range links {
+			if _, err := os.Stat(link); err != nil {
+				brokenLinks = append(brokenLinks, fmt.Sprintf("broken link in %s to %s", path, link))
+			}
+		}
+	}
+
+	if len(brokenLinks) <= v.maxBrokenLinks {
+		for _, link := range brokenLinks {
+			slog.Warn("tolerating broken link", "link", link)
+		}
+		return []string{}
+	}
+	return brokenLinks
+}
+
+func filePaths(topics []*model.Topic, articles []*model.Article) []string {
+	paths := make([]string, 0, len(topics)+len(articles))
+	for _, topic := range topics {
+		paths = append(paths, topic.FilePath)
+	}
+	for _, article := range articles {
+		paths = append(paths, article.FilePath)
+	}
+	return paths
+}
@@ -0,0 +1,101 @@
+package validating_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wamphlett/blog-server/pkg/model"
+	"github.com/wamphlett/blog-server/pkg/validating"
+)
+
+type stubReader struct {
+	headerProblems map[string][]error
+	links          map[string][]string
+}
+
+func (r stubReader) CheckFileHeaders(path string) []error {
+	return r.headerProblems[path]
+}
+
+func (r stubReader) GetRelativeLinks(path string) ([]string, error) {
+	if path == "unreadable.md" {
+		return nil, errors.New("failed to read file links")
+	}
+	return r.links[path], nil
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.md")
+	require.NoError(t, os.WriteFile(existing, []byte("# Existing"), 0o644))
+	missing := filepath.Join(dir, "missing.md")
+
+	topic := &model.Topic{Slug: "go", FilePath: "go/README.md"}
+	article := &model.Article{Slug: "intro", TopicSlug: "go", FilePath: "go/intro.md"}
+
+	for name, tc := range map[string]struct {
+		reader         stubReader
+		maxBrokenLinks int
+		topics         []*model.Topic
+		articles       []*model.Article
+		expected       []string
+	}{
+		"valid content": {
+			reader:   stubReader{links: map[string][]string{"go/intro.md": {existing}}},
+			topics:   []*model.Topic{topic},
+			articles: []*model.Article{article},
+			expected: []string{},
+		},
+		"invalid headers": {
+			reader:   stubReader{headerProblems: map[string][]error{"go/intro.md": {errors.New("invalid published header")}}},
+			topics:   []*model.Topic{topic},
+			articles: []*model.Article{article},
+			expected: []string{"invalid published header"},
+		},
+		"topic slug collision": {
+			topics:   []*model.Topic{topic, {Slug: "go", FilePath: "golang/README.md"}},
+			expected: []string{`topic slug "go" is used by both go/README.md and golang/README.md`},
+		},
+		"article slug collision": {
+			topics:   []*model.Topic{topic},
+			articles: []*model.Article{article, {Slug: "intro", TopicSlug: "go", FilePath: "go/introduction.md"}},
+			expected: []string{`article slug "go/intro" is used by both go/intro.md and go/introduction.md`},
+		},
+		"same article slug in different topics": {
+			topics:   []*model.Topic{topic, {Slug: "rust", FilePath: "rust/README.md"}},
+			articles: []*model.Article{article, {Slug: "intro", TopicSlug: "rust", FilePath: "rust/intro.md"}},
+			expected: []string{},
+		},
+		"broken link": {
+			reader:   stubReader{links: map[string][]string{"go/intro.md": {existing, missing}}},
+			articles: []*model.Article{article},
+			expected: []string{"broken link in go/intro.md to " + missing},
+		},
+		"tolerated broken link": {
+			reader:         stubReader{links: map[string][]string{"go/intro.md": {missing}}},
+			maxBrokenLinks: 1,
+			articles:       []*model.Article{article},
+			expected:       []string{},
+		},
+		"broken links beyond the threshold": {
+			reader:         stubReader{links: map[string][]string{"go/README.md": {missing}, "go/intro.md": {missing}}},
+			maxBrokenLinks: 1,
+			topics:         []*model.Topic{topic},
+			articles:       []*model.Article{article},
+			expected:       []string{"broken link in go/README.md to " + missing, "broken link in go/intro.md to " + missing},
+		},
+		"unreadable links": {
+			articles: []*model.Article{{Slug: "unreadable", TopicSlug: "go", FilePath: "unreadable.md"}},
+			expected: []string{"failed to read file links"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			validator := validating.New(tc.reader, validating.WithMaxBrokenLinks(tc.maxBrokenLinks))
+			require.Equal(t, tc.expected, validator.Validate(tc.topics, tc.articles))
+		})
+	}
+}